@@ -0,0 +1,11 @@
+package main
+
+import "net/http"
+
+func (a *serverApplication) alertsHandler(w http.ResponseWriter, r *http.Request) {
+	active, recent := a.app.AlertStatus()
+	a.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"active": active,
+		"recent": recent,
+	})
+}
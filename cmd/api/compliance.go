@@ -0,0 +1,20 @@
+package main
+
+import "net/http"
+
+func (a *serverApplication) complianceHandler(w http.ResponseWriter, r *http.Request) {
+	history, ok := a.app.ComplianceStatus()
+	if !ok {
+		http.Error(w, "No compliance checks configured", http.StatusNotFound)
+		return
+	}
+	if len(history) == 0 {
+		http.Error(w, "Compliance checks have not run yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"report":  history[len(history)-1],
+		"history": history,
+	})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"daemon/internal/file"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func (a *serverApplication) filesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	opts := file.ListOptions{
+		Glob:   query.Get("glob"),
+		Sort:   query.Get("sort"),
+		Cursor: query.Get("cursor"),
+	}
+
+	var err error
+	if s := query.Get("modified_since"); s != "" {
+		if opts.ModifiedSince, err = time.Parse(time.RFC3339, s); err != nil {
+			http.Error(w, "modified_since must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	if opts.MinSize, err = sizeParam(query.Get("min_size")); err != nil {
+		http.Error(w, fmt.Sprintf("min_size %v", err), http.StatusBadRequest)
+		return
+	}
+	if opts.MaxSize, err = sizeParam(query.Get("max_size")); err != nil {
+		http.Error(w, fmt.Sprintf("max_size %v", err), http.StatusBadRequest)
+		return
+	}
+	if s := query.Get("limit"); s != "" {
+		if opts.Limit, err = strconv.Atoi(s); err != nil || opts.Limit <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, found, err := a.app.ListFiles(query.Get("watch"), opts)
+	if !found {
+		http.Error(w, "No such watch entry", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, page)
+}
+
+func (a *serverApplication) fileEventsHandler(w http.ResponseWriter, r *http.Request) {
+	a.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"events": a.app.RecentFileEvents(),
+	})
+}
+
+// sizeParam parses an optional size in bytes.
+func sizeParam(s string) (*int64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	size, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("must be a size in bytes")
+	}
+	return &size, nil
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func (a *serverApplication) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	js, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		a.logger.Printf("Error encoding response: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(js, '\n'))
+}
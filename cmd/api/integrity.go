@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type IntegrityPayload struct {
+	Watch string `json:"watch"`
+	// Paths limits an accept to these files. All of them are accepted when
+	// it is empty.
+	Paths []string `json:"paths"`
+}
+
+func (a *serverApplication) integrityHandler(w http.ResponseWriter, r *http.Request) {
+	a.writeJSON(w, http.StatusOK, a.app.IntegrityStatus())
+}
+
+func (a *serverApplication) integrityAcceptHandler(w http.ResponseWriter, r *http.Request) {
+	var payload IntegrityPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	integrity := a.app.Integrity(payload.Watch)
+	if integrity == nil {
+		http.Error(w, "No integrity checks for this watch entry", http.StatusNotFound)
+		return
+	}
+	if integrity.Last() == nil {
+		http.Error(w, "Integrity has not been checked yet", http.StatusConflict)
+		return
+	}
+	if err := integrity.Accept(payload.Paths); err != nil {
+		http.Error(w, "Failed to accept the baseline", http.StatusInternalServerError)
+		a.logger.Printf("Error accepting integrity baseline: %v", err)
+		return
+	}
+	a.logger.Printf("Integrity baseline of %s accepted for %d paths", payload.Watch, len(payload.Paths))
+
+	a.writeJSON(w, http.StatusOK, integrity.Last())
+}
+
+func (a *serverApplication) integrityResetHandler(w http.ResponseWriter, r *http.Request) {
+	var payload IntegrityPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	integrity := a.app.Integrity(payload.Watch)
+	if integrity == nil {
+		http.Error(w, "No integrity checks for this watch entry", http.StatusNotFound)
+		return
+	}
+	if err := integrity.Reset(); err != nil {
+		http.Error(w, "Failed to reset the baseline", http.StatusInternalServerError)
+		a.logger.Printf("Error resetting integrity baseline: %v", err)
+		return
+	}
+	a.logger.Printf("Integrity baseline of %s reset", payload.Watch)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,13 @@
+package main
+
+import "net/http"
+
+func (a *serverApplication) inventoryHandler(w http.ResponseWriter, r *http.Request) {
+	inventory := a.app.LatestInventory()
+	if inventory == nil {
+		http.Error(w, "Host inventory not collected yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, inventory)
+}
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"daemon/internal/app"
+	"daemon/internal/service"
 	"embed"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/wailsapp/wails/v2"
@@ -16,8 +20,12 @@ import (
 )
 
 type config struct {
-	port int
-	env  string
+	port       int
+	env        string
+	headless   bool
+	configPath string
+	logFile    string
+	workDir    string
 }
 
 type serverApplication struct {
@@ -31,9 +39,21 @@ type serverApplication struct {
 var assets embed.FS
 
 func main() {
+	if handled, err := runServiceCommand(os.Args[1:]); handled {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var cfg config
 	flag.IntVar(&cfg.port, "port", 4000, "API server port")
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+	flag.BoolVar(&cfg.headless, "headless", false, "Run without the window and start collecting immediately")
+	flag.StringVar(&cfg.configPath, "config", "", "Config file (required with -headless)")
+	flag.StringVar(&cfg.logFile, "log-file", "", "Log file in headless mode (default ~/logs/daemon.log)")
+	flag.StringVar(&cfg.workDir, "work-dir", "", "Working directory in headless mode, also used as the home directory")
 	flag.Parse()
 	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
 	app := app.NewApp()
@@ -51,6 +71,35 @@ func main() {
 	}
 	app.Server = srv
 
+	if cfg.headless {
+		if cfg.configPath == "" {
+			logger.Fatal("-config is required with -headless")
+		}
+		if cfg.workDir != "" {
+			// Relative paths on the command line are relative to where the
+			// daemon was started, not to the working directory.
+			for _, path := range []*string{&cfg.configPath, &cfg.logFile} {
+				if *path != "" {
+					abs, err := filepath.Abs(*path)
+					if err != nil {
+						logger.Fatal(err)
+					}
+					*path = abs
+				}
+			}
+			if err := service.UseWorkingDirectory(cfg.workDir); err != nil {
+				logger.Fatal(err)
+			}
+		}
+		err := service.Run(service.DefaultName, func(ctx context.Context) error {
+			return app.RunHeadless(ctx, cfg.configPath, cfg.logFile)
+		})
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatal(err)
+		}
+		return
+	}
+
 	err := wails.Run(&options.App{
 		Title:             "daemon",
 		Width:             640,
@@ -0,0 +1,13 @@
+package main
+
+import "net/http"
+
+func (a *serverApplication) processesHandler(w http.ResponseWriter, r *http.Request) {
+	stats := a.app.LatestProcessStats()
+	if stats == nil {
+		http.Error(w, "Process stats not collected yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, stats)
+}
@@ -11,7 +11,19 @@ func (app *serverApplication) routes() *httprouter.Router {
 
 	router.HandlerFunc(http.MethodGet, "/v1/health", apiKeyMiddleware(app.healthCheckHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/stats", apiKeyMiddleware(app.logsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/stats/schema", apiKeyMiddleware(app.statsSchemaHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/files", apiKeyMiddleware(app.filesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/files/events", apiKeyMiddleware(app.fileEventsHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/command", apiKeyMiddleware(app.cpuCommandHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/processes", apiKeyMiddleware(app.processesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/network/sockets", apiKeyMiddleware(app.socketsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/alerts", apiKeyMiddleware(app.alertsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/inventory", apiKeyMiddleware(app.inventoryHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/software", apiKeyMiddleware(app.softwareHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/compliance", apiKeyMiddleware(app.complianceHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/integrity", apiKeyMiddleware(app.integrityHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/integrity/accept", apiKeyMiddleware(app.integrityAcceptHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/integrity/reset", apiKeyMiddleware(app.integrityResetHandler))
 	return router
 }
 
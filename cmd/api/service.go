@@ -0,0 +1,96 @@
+package main
+
+import (
+	"daemon/internal/service"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// runServiceCommand handles the install-service and uninstall-service
+// subcommands. It reports false for anything else.
+func runServiceCommand(args []string) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+	switch args[0] {
+	case "install-service":
+		return true, installService(args[1:])
+	case "uninstall-service":
+		return true, uninstallService(args[1:])
+	default:
+		return false, nil
+	}
+}
+
+func installService(args []string) error {
+	fs := flag.NewFlagSet("install-service", flag.ExitOnError)
+	name := fs.String("name", service.DefaultName, "Service name")
+	configPath := fs.String("config", "", "Config file the service loads (required)")
+	port := fs.Int("port", 4000, "API server port")
+	workDir := fs.String("work-dir", "", "Working directory, also holding the stats log and collector state (default per platform)")
+	logDir := fs.String("log-dir", "", "Log directory (default per platform)")
+	fs.Parse(args)
+
+	if *configPath == "" {
+		return fmt.Errorf("-config is required")
+	}
+	config, err := filepath.Abs(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve config path: %w", err)
+	}
+	if _, err := os.Stat(config); err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the daemon executable: %w", err)
+	}
+	executable, err = filepath.EvalSymlinks(executable)
+	if err != nil {
+		return fmt.Errorf("failed to find the daemon executable: %w", err)
+	}
+
+	if *workDir == "" {
+		*workDir = service.DefaultWorkingDirectory(*name)
+	}
+	if *logDir == "" {
+		*logDir = service.DefaultLogDirectory(*name)
+	}
+
+	err = service.Install(service.Config{
+		Name:        *name,
+		DisplayName: "Daemon monitoring agent",
+		Description: "Collects system, network and file statistics and reports them to the configured endpoint.",
+		Executable:  executable,
+		Args: []string{
+			"-headless",
+			"-config", config,
+			"-port", strconv.Itoa(*port),
+			"-log-file", filepath.Join(*logDir, "daemon.log"),
+			"-work-dir", *workDir,
+		},
+		WorkingDirectory: *workDir,
+		LogDirectory:     *logDir,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Service %s installed and started, logging to %s\n", *name, *logDir)
+	return nil
+}
+
+func uninstallService(args []string) error {
+	fs := flag.NewFlagSet("uninstall-service", flag.ExitOnError)
+	name := fs.String("name", service.DefaultName, "Service name")
+	fs.Parse(args)
+
+	if err := service.Uninstall(*name); err != nil {
+		return err
+	}
+	fmt.Printf("Service %s uninstalled\n", *name)
+	return nil
+}
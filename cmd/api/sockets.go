@@ -0,0 +1,13 @@
+package main
+
+import "net/http"
+
+func (a *serverApplication) socketsHandler(w http.ResponseWriter, r *http.Request) {
+	stats := a.app.LatestSocketStats()
+	if stats == nil {
+		http.Error(w, "Socket stats not collected yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, stats)
+}
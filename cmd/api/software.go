@@ -0,0 +1,13 @@
+package main
+
+import "net/http"
+
+func (a *serverApplication) softwareHandler(w http.ResponseWriter, r *http.Request) {
+	software := a.app.LatestSoftware()
+	if software == nil {
+		http.Error(w, "Software inventory not collected yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, software)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"daemon/internal/stats"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -23,13 +24,19 @@ func (a *serverApplication) logsHandler(w http.ResponseWriter, r *http.Request)
 	}
 	defer file.Close()
 
-	stats, err := os.ReadFile(logFilePath)
+	logs, err := os.ReadFile(logFilePath)
 	if err != nil {
 		http.Error(w, "Failed to read log file", http.StatusInternalServerError)
 		a.logger.Printf("Error reading log file: %v", err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/plain")
-	w.Write(stats)
+	// One JSON encoded stats.Sample per line.
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Write(logs)
+}
+
+func (a *serverApplication) statsSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(stats.Schema)
 }
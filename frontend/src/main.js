@@ -52,6 +52,7 @@ const toggleService = () => {
             })
             .catch((err) => {
                 console.error("Error starting service:", err);
+                resultElement.innerText = `Could not start the service: ${err}`;
             });
     }
 };
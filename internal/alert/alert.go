@@ -0,0 +1,209 @@
+package alert
+
+import (
+	"daemon/internal/stats"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Rule fires when Metric compares true against Threshold for For
+// consecutive samples, and resolves on the first sample where it does not.
+// A rule is evaluated separately for every series of the metric, so
+// "disk_used_percent > 95" covers each mount unless Labels narrows it down.
+// A series that is missing from a sample reporting other series of its
+// metric, such as an unmounted disk, is gone and resolves too.
+type Rule struct {
+	Name      string            `mapstructure:"name" validate:"required"`
+	Metric    string            `mapstructure:"metric" validate:"required"`
+	Operator  string            `mapstructure:"operator" validate:"required,oneof=> >= < <= == !="`
+	Threshold float64           `mapstructure:"threshold"`
+	For       int               `mapstructure:"for" validate:"min=0"`
+	Severity  string            `mapstructure:"severity"`
+	Labels    map[string]string `mapstructure:"labels"`
+}
+
+// historySize bounds how many state changes Recent keeps.
+const historySize = 100
+
+type series struct {
+	metric   string
+	breaches int
+	firing   *stats.Alert
+}
+
+// Engine tracks the state of every rule and series between samples. It only
+// reports state changes, so a rule that keeps firing is reported once.
+type Engine struct {
+	rules []Rule
+
+	mutex   sync.Mutex
+	series  map[string]*series
+	history []stats.Alert
+}
+
+func NewEngine(rules []Rule) *Engine {
+	return &Engine{
+		rules:  rules,
+		series: map[string]*series{},
+	}
+}
+
+// Evaluate checks the rules against the metrics of one sample and returns
+// the alerts that started firing or resolved.
+func (e *Engine) Evaluate(now time.Time, metrics []stats.Metric) []stats.Alert {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	reported := map[string]bool{}
+	for _, m := range metrics {
+		reported[m.Name] = true
+	}
+	seen := map[string]bool{}
+
+	var changes []stats.Alert
+	for _, rule := range e.rules {
+		for _, m := range metrics {
+			if m.Name != rule.Metric || !labelsMatch(rule.Labels, m.Labels) {
+				continue
+			}
+
+			key := rule.Name + "\x00" + m.String()
+			seen[key] = true
+			s, ok := e.series[key]
+			if !ok {
+				s = &series{metric: m.Name}
+				e.series[key] = s
+			}
+
+			if !compare(m.Value, rule.Operator, rule.Threshold) {
+				s.breaches = 0
+				if s.firing != nil {
+					resolved := *s.firing
+					resolvedAt := now.UTC()
+					resolved.State = stats.AlertResolved
+					resolved.Value = m.Value
+					resolved.ResolvedAt = &resolvedAt
+					resolved.Message = fmt.Sprintf("%s resolved: %s is %g", rule.Name, m, m.Value)
+					changes = append(changes, resolved)
+					s.firing = nil
+				}
+				continue
+			}
+
+			s.breaches++
+			if s.firing != nil || s.breaches < max(rule.For, 1) {
+				continue
+			}
+			severity := rule.Severity
+			if severity == "" {
+				severity = "warning"
+			}
+			s.firing = &stats.Alert{
+				Rule:      rule.Name,
+				Severity:  severity,
+				State:     stats.AlertFiring,
+				Metric:    m.Name,
+				Labels:    m.Labels,
+				Value:     m.Value,
+				Operator:  rule.Operator,
+				Threshold: rule.Threshold,
+				Message:   fmt.Sprintf("%s firing: %s is %g %s %g for %d samples", rule.Name, m, m.Value, rule.Operator, rule.Threshold, s.breaches),
+				FiredAt:   now.UTC(),
+			}
+			changes = append(changes, *s.firing)
+		}
+	}
+	changes = append(changes, e.dropMissing(now, reported, seen)...)
+
+	e.history = append(e.history, changes...)
+	if len(e.history) > historySize {
+		e.history = e.history[len(e.history)-historySize:]
+	}
+	return changes
+}
+
+// dropMissing forgets the series that are missing from a sample reporting
+// their metric, resolving the ones that were firing. A metric missing
+// altogether was just not collected this tick.
+func (e *Engine) dropMissing(now time.Time, reported, seen map[string]bool) []stats.Alert {
+	var gone []string
+	for key, s := range e.series {
+		if !seen[key] && reported[s.metric] {
+			gone = append(gone, key)
+		}
+	}
+	sort.Strings(gone)
+
+	var changes []stats.Alert
+	for _, key := range gone {
+		s := e.series[key]
+		delete(e.series, key)
+		if s.firing == nil {
+			continue
+		}
+		resolved := *s.firing
+		resolvedAt := now.UTC()
+		resolved.State = stats.AlertResolved
+		resolved.ResolvedAt = &resolvedAt
+		resolved.Message = fmt.Sprintf("%s resolved: %s is no longer reported", resolved.Rule, stats.Metric{Name: resolved.Metric, Labels: resolved.Labels})
+		changes = append(changes, resolved)
+	}
+	return changes
+}
+
+// Active returns the alerts currently firing.
+func (e *Engine) Active() []stats.Alert {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	active := []stats.Alert{}
+	for _, s := range e.series {
+		if s.firing != nil {
+			active = append(active, *s.firing)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].FiredAt.Before(active[j].FiredAt)
+	})
+	return active
+}
+
+// Recent returns the latest state changes, oldest first.
+func (e *Engine) Recent() []stats.Alert {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	recent := make([]stats.Alert, len(e.history))
+	copy(recent, e.history)
+	return recent
+}
+
+func compare(value float64, operator string, threshold float64) bool {
+	switch operator {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case "==":
+		return value == threshold
+	case "!=":
+		return value != threshold
+	default:
+		return false
+	}
+}
+
+func labelsMatch(want, have map[string]string) bool {
+	for k, v := range want {
+		if have[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+package alert
+
+import (
+	"daemon/internal/stats"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngineFiresAfterConsecutiveSamples(t *testing.T) {
+	engine := NewEngine([]Rule{{Name: "high_cpu", Metric: "cpu_percent", Operator: ">", Threshold: 90, For: 3}})
+	now := time.Now()
+	cpu := func(v float64) []stats.Metric {
+		return []stats.Metric{{Name: "cpu_percent", Value: v}}
+	}
+
+	assert.Empty(t, engine.Evaluate(now, cpu(95)))
+	assert.Empty(t, engine.Evaluate(now, cpu(50)))
+	assert.Empty(t, engine.Evaluate(now, cpu(95)))
+	assert.Empty(t, engine.Evaluate(now, cpu(96)))
+
+	fired := engine.Evaluate(now, cpu(97))
+	require.Len(t, fired, 1)
+	assert.Equal(t, stats.AlertFiring, fired[0].State)
+	assert.Equal(t, 97.0, fired[0].Value)
+
+	// Still breaching, but already reported.
+	assert.Empty(t, engine.Evaluate(now, cpu(99)))
+	assert.Len(t, engine.Active(), 1)
+
+	resolved := engine.Evaluate(now, cpu(10))
+	require.Len(t, resolved, 1)
+	assert.Equal(t, stats.AlertResolved, resolved[0].State)
+	assert.NotNil(t, resolved[0].ResolvedAt)
+	assert.Empty(t, engine.Active())
+	assert.Len(t, engine.Recent(), 2)
+}
+
+func TestEngineTracksEachSeries(t *testing.T) {
+	engine := NewEngine([]Rule{{Name: "disk_full", Metric: "disk_used_percent", Operator: ">", Threshold: 95}})
+	metrics := []stats.Metric{
+		{Name: "disk_used_percent", Labels: map[string]string{"mount": "/"}, Value: 40},
+		{Name: "disk_used_percent", Labels: map[string]string{"mount": "/data"}, Value: 98},
+	}
+
+	fired := engine.Evaluate(time.Now(), metrics)
+	require.Len(t, fired, 1)
+	assert.Equal(t, "/data", fired[0].Labels["mount"])
+}
+
+func TestEngineResolvesSeriesThatDisappear(t *testing.T) {
+	engine := NewEngine([]Rule{{Name: "disk_full", Metric: "disk_used_percent", Operator: ">", Threshold: 95}})
+	now := time.Now()
+	root := stats.Metric{Name: "disk_used_percent", Labels: map[string]string{"mount": "/"}, Value: 40}
+	usb := stats.Metric{Name: "disk_used_percent", Labels: map[string]string{"mount": "/media/usb"}, Value: 99}
+
+	fired := engine.Evaluate(now, []stats.Metric{root, usb})
+	require.Len(t, fired, 1)
+
+	// A sample without disk stats says nothing about the mount.
+	assert.Empty(t, engine.Evaluate(now, []stats.Metric{{Name: "cpu_percent", Value: 10}}))
+	assert.Len(t, engine.Active(), 1)
+
+	// Disk stats without the mount mean it is gone.
+	resolved := engine.Evaluate(now, []stats.Metric{root})
+	require.Len(t, resolved, 1)
+	assert.Equal(t, stats.AlertResolved, resolved[0].State)
+	assert.Equal(t, "/media/usb", resolved[0].Labels["mount"])
+	assert.Contains(t, resolved[0].Message, "no longer reported")
+	assert.Empty(t, engine.Active())
+
+	// Coming back, it starts over.
+	fired = engine.Evaluate(now, []stats.Metric{root, usb})
+	require.Len(t, fired, 1)
+	assert.Equal(t, stats.AlertFiring, fired[0].State)
+}
@@ -0,0 +1,191 @@
+package anomaly
+
+import (
+	"daemon/internal/state"
+	"daemon/internal/stats"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAlpha     = 0.05
+	defaultThreshold = 3
+	defaultWarmup    = 30
+
+	// saveInterval limits how often the baselines are written to the state
+	// store. Losing the last minute of learning on a crash is harmless.
+	saveInterval = time.Minute
+	stateName    = "anomaly/baselines"
+)
+
+type Settings struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Alpha is the weight of each new sample in the moving mean and
+	// variance. Smaller values learn slower and remember longer. Defaults
+	// to 0.05.
+	Alpha float64 `mapstructure:"alpha" validate:"omitempty,gt=0,lt=1"`
+	// Threshold is how many standard deviations from the mean a value has
+	// to be to count as an anomaly. Defaults to 3.
+	Threshold float64 `mapstructure:"threshold" validate:"omitempty,gt=0"`
+	// Warmup is the number of samples a baseline learns from before it is
+	// used. Defaults to 30.
+	Warmup int `mapstructure:"warmup" validate:"omitempty,min=1"`
+	// HourOfDay keeps a separate baseline for every hour of the local day,
+	// for hosts whose load follows working hours or nightly jobs.
+	HourOfDay bool `mapstructure:"hour_of_day"`
+	// Metrics limits detection to the named metrics. Empty means all.
+	Metrics []string `mapstructure:"metrics"`
+}
+
+// baseline is an exponentially weighted mean and variance of one series.
+type baseline struct {
+	Count    int     `json:"count"`
+	Mean     float64 `json:"mean"`
+	Variance float64 `json:"variance"`
+}
+
+// update folds value into the baseline (West, 1979).
+func (b *baseline) update(value, alpha float64) {
+	b.Count++
+	if b.Count == 1 {
+		b.Mean = value
+		b.Variance = 0
+		return
+	}
+	diff := value - b.Mean
+	incr := alpha * diff
+	b.Mean += incr
+	b.Variance = (1 - alpha) * (b.Variance + diff*incr)
+}
+
+// Detector learns a baseline for every metric series and flags values that
+// stray too far from it. Baselines are kept in the state store so that a
+// restart does not start the warmup over.
+type Detector struct {
+	settings Settings
+	store    *state.Store
+	metrics  map[string]bool
+
+	mutex     sync.Mutex
+	baselines map[string]*baseline
+	lastSave  time.Time
+}
+
+// NewDetector loads the saved baselines from store, when set. A corrupt
+// state file is logged and removed, and learning starts over.
+func NewDetector(settings Settings, store *state.Store, logger *log.Logger) (*Detector, error) {
+	if settings.Alpha == 0 {
+		settings.Alpha = defaultAlpha
+	}
+	if settings.Threshold == 0 {
+		settings.Threshold = defaultThreshold
+	}
+	if settings.Warmup == 0 {
+		settings.Warmup = defaultWarmup
+	}
+
+	d := &Detector{
+		settings:  settings,
+		store:     store,
+		baselines: map[string]*baseline{},
+	}
+	if len(settings.Metrics) > 0 {
+		d.metrics = map[string]bool{}
+		for _, name := range settings.Metrics {
+			d.metrics[name] = true
+		}
+	}
+
+	if store != nil {
+		_, err := store.Load(stateName, &d.baselines)
+		if errors.Is(err, state.ErrCorrupt) {
+			logger.Printf("Discarding anomaly baselines: %v", err)
+			d.baselines = map[string]*baseline{}
+			err = store.Delete(stateName)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load anomaly baselines: %w", err)
+		}
+	}
+	return d, nil
+}
+
+// Evaluate compares the metrics of one sample with their baselines, then
+// folds them in. A value is only judged once its baseline has seen Warmup
+// samples, and never against a baseline that has not varied at all, where
+// any change would be infinitely many deviations away.
+func (d *Detector) Evaluate(now time.Time, metrics []stats.Metric) ([]stats.Anomaly, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var hour *int
+	if d.settings.HourOfDay {
+		h := now.Local().Hour()
+		hour = &h
+	}
+
+	var anomalies []stats.Anomaly
+	for _, m := range metrics {
+		if d.metrics != nil && !d.metrics[m.Name] {
+			continue
+		}
+
+		key := m.String()
+		if hour != nil {
+			key = fmt.Sprintf("%s@%02d", key, *hour)
+		}
+		b, ok := d.baselines[key]
+		if !ok {
+			b = &baseline{}
+			d.baselines[key] = b
+		}
+
+		stdDev := math.Sqrt(b.Variance)
+		if b.Count >= d.settings.Warmup && stdDev > 0 {
+			score := (m.Value - b.Mean) / stdDev
+			if math.Abs(score) >= d.settings.Threshold {
+				anomalies = append(anomalies, stats.Anomaly{
+					Metric:   m.Name,
+					Labels:   m.Labels,
+					Value:    m.Value,
+					Expected: b.Mean,
+					StdDev:   stdDev,
+					Score:    score,
+					Hour:     hour,
+				})
+			}
+		}
+
+		b.update(m.Value, d.settings.Alpha)
+	}
+
+	if now.Sub(d.lastSave) >= saveInterval {
+		if err := d.save(); err != nil {
+			return anomalies, err
+		}
+		d.lastSave = now
+	}
+	return anomalies, nil
+}
+
+// Save writes the baselines to the state store. Evaluate already saves
+// them every minute; Save is for shutting down.
+func (d *Detector) Save() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.save()
+}
+
+func (d *Detector) save() error {
+	if d.store == nil {
+		return nil
+	}
+	if err := d.store.Save(stateName, d.baselines); err != nil {
+		return fmt.Errorf("failed to save anomaly baselines: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package anomaly
+
+import (
+	"daemon/internal/state"
+	"daemon/internal/stats"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var discard = log.New(io.Discard, "", 0)
+
+func cpu(v float64) []stats.Metric {
+	return []stats.Metric{{Name: "cpu_percent", Value: v}}
+}
+
+func TestDetectorFlagsDeviationAfterWarmup(t *testing.T) {
+	d, err := NewDetector(Settings{Enabled: true, Alpha: 0.1, Warmup: 20}, nil, discard)
+	require.NoError(t, err)
+	now := time.Now()
+
+	for i := 0; i < 20; i++ {
+		anomalies, err := d.Evaluate(now, cpu(float64(10+i%3)))
+		require.NoError(t, err)
+		assert.Empty(t, anomalies, "no anomalies during warmup")
+	}
+
+	anomalies, err := d.Evaluate(now, cpu(11))
+	require.NoError(t, err)
+	assert.Empty(t, anomalies)
+
+	anomalies, err = d.Evaluate(now, cpu(90))
+	require.NoError(t, err)
+	require.Len(t, anomalies, 1)
+	assert.Equal(t, 90.0, anomalies[0].Value)
+	assert.InDelta(t, 11, anomalies[0].Expected, 1)
+	assert.Greater(t, anomalies[0].Score, 3.0)
+}
+
+func TestDetectorIgnoresFlatBaseline(t *testing.T) {
+	d, err := NewDetector(Settings{Enabled: true, Warmup: 5}, nil, discard)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		_, err := d.Evaluate(time.Now(), cpu(50))
+		require.NoError(t, err)
+	}
+	anomalies, err := d.Evaluate(time.Now(), cpu(51))
+	require.NoError(t, err)
+	assert.Empty(t, anomalies)
+}
+
+func TestDetectorPersistsBaselines(t *testing.T) {
+	store := &state.Store{Dir: t.TempDir()}
+	d, err := NewDetector(Settings{Enabled: true, Warmup: 3}, store, discard)
+	require.NoError(t, err)
+	for _, v := range []float64{10, 12, 11, 13} {
+		_, err := d.Evaluate(time.Now(), cpu(v))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, d.Save())
+
+	restored, err := NewDetector(Settings{Enabled: true, Warmup: 3}, store, discard)
+	require.NoError(t, err)
+	require.Contains(t, restored.baselines, "cpu_percent")
+	assert.Equal(t, 4, restored.baselines["cpu_percent"].Count)
+}
+
+func TestDetectorDiscardsCorruptBaselines(t *testing.T) {
+	store := &state.Store{Dir: t.TempDir()}
+	path := filepath.Join(store.Dir, filepath.FromSlash(stateName)+".json")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(`{"cpu_percent": {"mean": 1`), 0644))
+
+	d, err := NewDetector(Settings{Enabled: true, Warmup: 3}, store, discard)
+	require.NoError(t, err)
+	assert.Empty(t, d.baselines)
+	assert.NoFileExists(t, path)
+
+	_, err = d.Evaluate(time.Now(), cpu(10))
+	require.NoError(t, err)
+	require.NoError(t, d.Save())
+	assert.FileExists(t, path)
+}
@@ -0,0 +1,524 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"daemon/commands"
+	"daemon/dialog"
+	"daemon/internal/alert"
+	"daemon/internal/collector"
+	"daemon/internal/compliance"
+	"daemon/internal/file"
+	"daemon/internal/monitor"
+	"daemon/internal/query"
+	"daemon/internal/stats"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type App struct {
+	ctx           context.Context
+	config        Config
+	configLoaded  bool
+	logger        *log.Logger
+	logBuffer     *bytes.Buffer
+	osquery       query.Osquery
+	WorkerQueue   chan string
+	fileEvents    []FileEvent
+	statsLog      *file.File
+	processStats  *monitor.ProcessStats
+	socketStats   *monitor.SocketStats
+	inventory     *monitor.HostInventory
+	software      *monitor.SoftwareStats
+	checks        []compliance.Check
+	compliance    *compliance.Collector
+	files         []*collector.Files
+	integrity     []*collector.Integrity
+	alerts        *alert.Engine
+	dialog        dialog.Dialog
+	mutex         sync.Mutex
+	Server        *http.Server
+	stopWorker    chan struct{}
+	stopTimer     chan struct{}
+	workerRunning bool
+	timerRunning  bool
+}
+
+// maxFileEvents bounds the file events kept in memory.
+const maxFileEvents = 1000
+
+// FileEvent is a file event with the watch entry it was seen in.
+type FileEvent struct {
+	Watch string `json:"watch"`
+	file.Event
+}
+
+func NewApp() *App {
+	logBuffer := new(bytes.Buffer)
+	multiWriter := io.MultiWriter(os.Stdout, logBuffer)
+	logger := log.New(multiWriter, "AppLogger: ", log.LstdFlags)
+	return &App{
+		WorkerQueue: make(chan string, 100),
+		logBuffer:   logBuffer,
+		logger:      logger,
+		statsLog:    &file.File{Logger: logger},
+		osquery:     query.Osquery{Logger: logger},
+		dialog:      &dialog.WailsDialog{},
+		// Buffered so that StopService, which holds the mutex, does not
+		// wait for a tick in progress that needs the mutex to finish.
+		stopWorker: make(chan struct{}, 1),
+		stopTimer:  make(chan struct{}, 1),
+	}
+}
+
+func (a *App) Startup(ctx context.Context) {
+	a.ctx = ctx
+	err := a.loadConfig(ctx)
+	if err != nil {
+		a.logger.Println("Could not load config:", err)
+	} else {
+		a.logger.Println("Config loaded:", a.config)
+	}
+
+	err = a.osquery.InitOsquery()
+	if err != nil {
+		a.logger.Println("Could not connect to osquery:", err)
+	}
+
+	startTray(ctx)
+
+	a.logger.Printf("starting server on %s", a.Server.Addr)
+	err = a.Server.ListenAndServe()
+	a.logger.Fatal(err)
+
+}
+
+// RunHeadless runs the daemon without the Wails window, for servers with no
+// display and for running as a service. It reads the config from configPath,
+// starts collecting right away and serves the API until ctx is cancelled.
+// Logs go to stdout and to logPath, ~/logs/daemon.log when empty.
+func (a *App) RunHeadless(ctx context.Context, configPath, logPath string) error {
+	a.ctx = ctx
+	logFile, err := a.logToFile(logPath)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	if err := a.readConfig(configPath); err != nil {
+		return fmt.Errorf("could not load config: %w", err)
+	}
+	a.logger.Println("Config loaded:", a.config)
+
+	if err := a.osquery.InitOsquery(); err != nil {
+		a.logger.Println("Could not connect to osquery:", err)
+	}
+
+	if _, err := a.StartService(); err != nil {
+		return err
+	}
+	defer a.StopService()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		a.logger.Printf("starting server on %s", a.Server.Addr)
+		serveErr <- a.Server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	a.logger.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return a.Server.Shutdown(shutdownCtx)
+}
+
+// logToFile sends the app logger and the standard logger to stdout and the
+// file at path. The in-memory buffer behind FetchLogs is dropped, since
+// nothing reads it without the window.
+func (a *App) logToFile(path string) (*os.File, error) {
+	if path == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user home directory: %w", err)
+		}
+		path = filepath.Join(homeDir, "logs", "daemon.log")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	logFile, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	out := io.MultiWriter(os.Stdout, logFile)
+	a.logger.SetOutput(out)
+	log.SetOutput(out)
+	return logFile, nil
+}
+
+func (a *App) StartService() (string, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	// The collectors need the watch entries and the endpoint of a valid
+	// config.
+	if !a.configLoaded {
+		return "", fmt.Errorf("cannot start the service without a valid config")
+	}
+	if !a.workerRunning {
+		go a.workerThread()
+		a.workerRunning = true
+	}
+	if !a.timerRunning {
+		go a.timerThread()
+		a.timerRunning = true
+	}
+	return "Service started", nil
+}
+
+func (a *App) FetchLogs() (string, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	logs := a.logBuffer.String()
+
+	a.logBuffer.Reset()
+
+	return logs, nil
+}
+
+// LatestProcessStats returns the most recent top process report, or nil
+// before the first collection.
+func (a *App) LatestProcessStats() *monitor.ProcessStats {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.processStats
+}
+
+// LatestSocketStats returns the most recent listening port and connection
+// inventory, or nil before the first collection.
+func (a *App) LatestSocketStats() *monitor.SocketStats {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.socketStats
+}
+
+// LatestInventory returns the most recent host inventory, or nil before the
+// first collection.
+func (a *App) LatestInventory() *monitor.HostInventory {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.inventory
+}
+
+// LatestSoftware returns the most recent software inventory and the changes
+// it found, or nil before the first collection.
+func (a *App) LatestSoftware() *monitor.SoftwareStats {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.software
+}
+
+// ComplianceStatus returns the compliance reports kept, oldest first, or
+// false when no compliance checks are configured.
+func (a *App) ComplianceStatus() ([]stats.ComplianceReport, bool) {
+	a.mutex.Lock()
+	checks := a.compliance
+	a.mutex.Unlock()
+	if checks == nil {
+		return nil, false
+	}
+	return checks.History(), true
+}
+
+// ListFiles pages through the files of the latest scan of each watch entry,
+// or only of the named one when watch is set. It reports false when no watch
+// entry has that name. Entries not scanned yet list no files.
+func (a *App) ListFiles(watch string, opts file.ListOptions) (*file.Page, bool, error) {
+	a.mutex.Lock()
+	collectors := a.files
+	a.mutex.Unlock()
+
+	// The collectors only exist once the first tick started, so the config
+	// tells which entries there are.
+	found := watch == ""
+	for _, w := range a.config.Watches {
+		if w.Name == watch {
+			found = true
+		}
+	}
+	var listings []file.WatchListing
+	for _, c := range collectors {
+		if watch != "" && c.Watch != watch {
+			continue
+		}
+		if files, ok := c.File.Listing(); ok {
+			listings = append(listings, file.WatchListing{
+				Watch: c.Watch,
+				Root:  c.File.MonitorDirectory,
+				Files: files,
+			})
+		}
+	}
+	if !found {
+		return nil, false, nil
+	}
+	opts.Watch = watch
+	page, err := file.ListFiles(listings, opts)
+	return page, true, err
+}
+
+// IntegrityStatus returns the latest integrity check of each watch entry
+// with integrity enabled, leaving out the ones not checked yet.
+func (a *App) IntegrityStatus() []stats.IntegrityStats {
+	a.mutex.Lock()
+	checks := a.integrity
+	a.mutex.Unlock()
+
+	status := []stats.IntegrityStats{}
+	for _, c := range checks {
+		if report := c.Integrity.Last(); report != nil {
+			status = append(status, stats.IntegrityStats{
+				Name:            c.Watch,
+				Path:            c.Integrity.File.MonitorDirectory,
+				Labels:          c.Labels,
+				IntegrityReport: *report,
+			})
+		}
+	}
+	return status
+}
+
+// Integrity returns the integrity checks of the named watch entry, or nil
+// when it has none.
+func (a *App) Integrity(watch string) *file.Integrity {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for _, c := range a.integrity {
+		if c.Watch == watch {
+			return c.Integrity
+		}
+	}
+	return nil
+}
+
+// hostContext identifies this host in a sample. It must be called with the
+// mutex held.
+func (a *App) hostContext() *stats.Host {
+	if a.inventory != nil {
+		return &stats.Host{Hostname: a.inventory.Hostname, UUID: a.inventory.UUID}
+	}
+	hostname, _ := os.Hostname()
+	return &stats.Host{Hostname: hostname}
+}
+
+// AlertStatus returns the alerts currently firing and the latest firing and
+// resolved transitions, oldest first.
+func (a *App) AlertStatus() (active, recent []stats.Alert) {
+	a.mutex.Lock()
+	engine := a.alerts
+	a.mutex.Unlock()
+	if engine == nil {
+		return []stats.Alert{}, []stats.Alert{}
+	}
+	return engine.Active(), engine.Recent()
+}
+
+// RecentFileEvents returns the latest file events of every watch entry,
+// oldest first, at most maxFileEvents of them.
+func (a *App) RecentFileEvents() []FileEvent {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return append([]FileEvent{}, a.fileEvents...)
+}
+
+func (a *App) StopService() (string, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.workerRunning {
+		a.stopWorker <- struct{}{}
+		a.workerRunning = false
+	}
+	if a.timerRunning {
+		a.stopTimer <- struct{}{}
+		a.timerRunning = false
+	}
+	return "Service stopped", nil
+}
+
+func (a *App) workerThread() {
+	a.logger.Println("Worker thread started")
+	var frequency int
+	if a.config.CheckFrequency == 0 {
+		frequency = 1
+	} else {
+		frequency = a.config.CheckFrequency
+	}
+	whitelist := commands.GetWhitelist()
+	ticker := time.NewTicker(time.Duration(frequency) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case cmdStr := <-a.WorkerQueue:
+			a.logger.Printf("Received command: %s", cmdStr)
+
+			if _, allowed := whitelist[cmdStr]; !allowed {
+				a.logger.Printf("Command not allowed: %s", cmdStr)
+				continue
+			}
+			cmd := shellCommand(cmdStr)
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				a.logger.Printf("Error executing command: %v, output: %s", err, output)
+				continue
+			}
+			a.logger.Printf("Command output: %s", output)
+		case <-a.stopWorker:
+			a.logger.Println("Worker thread stopped")
+			return
+		}
+	}
+}
+
+func (a *App) timerThread() {
+	// Cancelling ctx also stops the file watchers.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	registry := a.newCollectorRegistry(ctx)
+	alerts := alert.NewEngine(a.config.Alerts)
+	a.mutex.Lock()
+	a.alerts = alerts
+	a.mutex.Unlock()
+	detector := a.newAnomalyDetector()
+
+	// Collectors keep their own schedules, the ticker only decides how
+	// often the registry checks which of them are due.
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	a.logger.Println("Timer thread started with collectors:", registry.Names())
+
+	for {
+		select {
+		case now := <-ticker.C:
+			sample := registry.Collect(ctx, now)
+			if sample == nil {
+				continue
+			}
+
+			a.mutex.Lock()
+			if sample.Inventory != nil {
+				a.inventory = sample.Inventory
+			}
+			if sample.Software != nil {
+				a.software = sample.Software
+				for _, event := range sample.Software.Events {
+					a.logger.Printf("Software %s: %s %s", event.Type, event.Package.Name, event.Package.Version)
+				}
+			}
+			for _, check := range sample.Integrity {
+				for _, v := range check.Violations {
+					a.logger.Printf("Integrity violation (%s): %s %s", check.Name, v.Type, v.Path)
+				}
+			}
+			sample.Host = a.hostContext()
+			a.mutex.Unlock()
+
+			metrics := sample.Metrics()
+			sample.Alerts = alerts.Evaluate(now, metrics)
+			for _, change := range sample.Alerts {
+				a.logger.Printf("Alert %s: %s", change.State, change.Message)
+			}
+			if detector != nil {
+				anomalies, err := detector.Evaluate(now, metrics)
+				if err != nil {
+					a.logger.Printf("Error evaluating anomalies: %v", err)
+				}
+				sample.Anomalies = anomalies
+				for _, found := range anomalies {
+					series := stats.Metric{Name: found.Metric, Labels: found.Labels}
+					a.logger.Printf("Anomaly: %s is %g, expected %.2f (score %.1f)", series, found.Value, found.Expected, found.Score)
+				}
+			}
+
+			a.mutex.Lock()
+			for _, w := range sample.Watches {
+				for _, e := range w.Events {
+					a.fileEvents = append(a.fileEvents, FileEvent{Watch: w.Name, Event: e})
+				}
+			}
+			if len(a.fileEvents) > maxFileEvents {
+				a.fileEvents = a.fileEvents[len(a.fileEvents)-maxFileEvents:]
+			}
+			if sample.Processes != nil {
+				a.processStats = sample.Processes
+			}
+			if sample.Sockets != nil {
+				a.socketStats = sample.Sockets
+			}
+			a.mutex.Unlock()
+
+			if err := a.statsLog.SaveStatsToFile(sample); err != nil {
+				a.logger.Printf("Error saving stats to file: %v", err)
+			}
+
+			// Collectors that report changes only save their new state
+			// once the sample is delivered, so a failed upload repeats the
+			// changes next time rather than losing them.
+			if err := a.sendStatsToAPI(sample); err != nil {
+				a.logger.Printf("Error sending stats to API: %v", err)
+			} else {
+				registry.Commit()
+			}
+		case <-a.stopTimer:
+			if detector != nil {
+				if err := detector.Save(); err != nil {
+					a.logger.Printf("Error saving anomaly baselines: %v", err)
+				}
+			}
+			a.logger.Println("Timer thread stopped")
+			return
+		}
+	}
+}
+
+func (a *App) sendStatsToAPI(sample *stats.Sample) error {
+	data, err := json.Marshal(sample)
+	if err != nil {
+		return fmt.Errorf("failed to marshal stats to JSON: %w", err)
+	}
+
+	apiEndpoint := a.config.APIEndpoint
+
+	req, err := http.NewRequest("POST", apiEndpoint, bytes.NewBuffer(data))
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send stats to API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("API responded with status: %s", resp.Status)
+	}
+
+	a.logger.Println("Successfully sent stats to API")
+	return nil
+}
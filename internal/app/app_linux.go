@@ -0,0 +1,13 @@
+package app
+
+import (
+	"context"
+	"os/exec"
+)
+
+// startTray does nothing, there is no tray icon on Linux.
+func startTray(ctx context.Context) {}
+
+func shellCommand(cmdStr string) *exec.Cmd {
+	return exec.Command("sh", "-c", cmdStr)
+}
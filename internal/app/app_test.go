@@ -0,0 +1,40 @@
+package app
+
+import (
+	"daemon/internal/collector"
+	"daemon/internal/file"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListFilesBeforeFirstScan(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0644))
+	a := &App{config: Config{Watches: []file.Watch{{Name: "Documents", Path: root}}}}
+
+	// The collectors are not even built yet.
+	page, found, err := a.ListFiles("Documents", file.ListOptions{})
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Empty(t, page.Files)
+
+	_, found, _ = a.ListFiles("Desktop", file.ListOptions{})
+	assert.False(t, found)
+
+	files := &collector.Files{File: &file.File{MonitorDirectory: root, Native: true}, Watch: "Documents"}
+	a.files = []*collector.Files{files}
+	page, _, err = a.ListFiles("Documents", file.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, page.Files)
+
+	_, err = files.File.GetFileChanges()
+	require.NoError(t, err)
+	page, _, err = a.ListFiles("Documents", file.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, page.Files, 1)
+	assert.Equal(t, "Documents", page.Files[0].Watch)
+}
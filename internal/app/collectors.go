@@ -0,0 +1,246 @@
+package app
+
+import (
+	"context"
+	"daemon/internal/anomaly"
+	"daemon/internal/collector"
+	"daemon/internal/compliance"
+	"daemon/internal/file"
+	"daemon/internal/monitor"
+	"daemon/internal/pack"
+	"daemon/internal/state"
+	"runtime"
+	"time"
+)
+
+// collectorNames are the keys accepted under "collectors" in the config.
+// Watch entries share the files and integrity settings, and query packs
+// take their schedule from the pack.
+var collectorNames = []string{
+	"files", "integrity", "system", "network", "processes", "sockets",
+	"inventory", "software", "compliance",
+}
+
+// newCollectorRegistry wires the built-in collectors. Each one can be
+// disabled or given its own interval and timeout under "collectors" in the
+// config, keyed by collector name.
+func (a *App) newCollectorRegistry(ctx context.Context) *collector.Registry {
+	frequency := a.config.CheckFrequency
+	if frequency == 0 {
+		frequency = 1
+	}
+	registry := collector.NewRegistry(collector.Settings{
+		Interval: time.Duration(frequency) * time.Second,
+	}, a.logger)
+
+	register := func(c collector.Collector) {
+		registry.Register(c, a.config.Collectors[c.Name()])
+	}
+
+	native := a.useNativeBackend()
+	if native {
+		a.logger.Println("Collecting files, system, network and inventory natively")
+	}
+
+	// Without a state directory, changes made while the daemon was down go
+	// unreported and query packs are disabled.
+	store, storeErr := a.stateStore()
+	if storeErr != nil {
+		a.logger.Printf("Collector state will not be kept across restarts: %v", storeErr)
+	}
+
+	// Every watch entry is its own files collector, so that each keeps its
+	// own schedule. collectors.files applies to all of them.
+	var filesCollectors []*collector.Files
+	var integrityChecks []*collector.Integrity
+	for _, w := range a.config.Watches {
+		settings := a.config.Collectors["files"]
+		if w.Interval > 0 {
+			settings.Interval = w.Interval
+		}
+		files := &collector.Files{
+			File: &file.File{
+				OsqueryInstance:   a.osquery.OsqueryInstance,
+				OsquerySocketPath: a.osquery.OsquerySocketPath,
+				MonitorDirectory:  w.Path,
+				Scan:              w.Scan,
+				Logger:            a.logger,
+				Native:            native,
+				Store:             store,
+			},
+			Watch:  w.Name,
+			Labels: w.Labels,
+		}
+		if w.Mode == "watch" {
+			files.Watcher = &file.Watcher{
+				File:      files.File,
+				Debounce:  w.Debounce,
+				Reconcile: w.Reconcile,
+				Logger:    a.logger,
+			}
+		}
+		// A disabled collector would never take what the watcher reports.
+		if registry.Register(files, settings) && files.Watcher != nil {
+			go files.RunWatcher(ctx, a.logger)
+		}
+		filesCollectors = append(filesCollectors, files)
+
+		// Integrity checks follow the schedule of the entry unless
+		// collectors.integrity sets their own, which is worth doing on a
+		// large tree since every check hashes every file.
+		if w.Integrity {
+			checks := a.config.Collectors["integrity"]
+			if checks.Interval <= 0 {
+				checks.Interval = settings.Interval
+			}
+			integrity := &collector.Integrity{
+				Integrity: &file.Integrity{File: files.File},
+				Watch:     w.Name,
+				Labels:    w.Labels,
+			}
+			registry.Register(integrity, checks)
+			integrityChecks = append(integrityChecks, integrity)
+		}
+	}
+	a.mutex.Lock()
+	a.files = filesCollectors
+	a.integrity = integrityChecks
+	a.mutex.Unlock()
+
+	// The system stats report the mount of the first watch entry, or none
+	// without one.
+	var mount string
+	if len(a.config.Watches) > 0 {
+		mount = a.config.Watches[0].Path
+	}
+	register(&collector.System{Monitor: &monitor.Monitor{
+		OsqueryInstance:   a.osquery.OsqueryInstance,
+		OsquerySocketPath: a.osquery.OsquerySocketPath,
+		MonitorDirectory:  mount,
+
+		IncludePseudoFilesystems: a.config.IncludePseudoFilesystems,
+		Native:                   native,
+	}})
+	register(&collector.Network{Network: &monitor.Network{
+		OsqueryInstance:   a.osquery.OsqueryInstance,
+		OsquerySocketPath: a.osquery.OsquerySocketPath,
+		IncludeInterfaces: a.config.NetworkIncludeInterfaces,
+		ExcludeInterfaces: a.config.NetworkExcludeInterfaces,
+		Native:            native,
+	}})
+	register(&collector.Processes{Processes: &monitor.Processes{
+		OsqueryInstance:   a.osquery.OsqueryInstance,
+		OsquerySocketPath: a.osquery.OsquerySocketPath,
+		TopN:              a.config.TopProcesses,
+	}})
+	register(&collector.Sockets{Sockets: &monitor.Sockets{
+		OsqueryInstance:   a.osquery.OsqueryInstance,
+		OsquerySocketPath: a.osquery.OsquerySocketPath,
+		Logger:            a.logger,
+	}})
+
+	// The inventory runs at startup and then daily unless configured
+	// otherwise.
+	inventory := a.config.Collectors["inventory"]
+	if inventory.Interval <= 0 {
+		inventory.Interval = 24 * time.Hour
+	}
+	registry.Register(&collector.Inventory{Inventory: &monitor.Inventory{
+		OsqueryInstance:   a.osquery.OsqueryInstance,
+		OsquerySocketPath: a.osquery.OsquerySocketPath,
+		Native:            native,
+	}}, inventory)
+
+	// Installed software changes rarely and listing it is expensive, so it
+	// runs hourly unless configured otherwise.
+	software := a.config.Collectors["software"]
+	if software.Interval <= 0 {
+		software.Interval = time.Hour
+	}
+	registry.Register(&collector.Software{Software: &monitor.Software{
+		OsqueryInstance:   a.osquery.OsqueryInstance,
+		OsquerySocketPath: a.osquery.OsquerySocketPath,
+		Store:             store,
+	}}, software)
+
+	// Compliance checks also default to hourly.
+	if len(a.checks) > 0 {
+		settings := a.config.Collectors["compliance"]
+		if settings.Interval <= 0 {
+			settings.Interval = time.Hour
+		}
+		checks := &compliance.Collector{
+			OsqueryInstance:   a.osquery.OsqueryInstance,
+			OsquerySocketPath: a.osquery.OsquerySocketPath,
+			Checks:            a.checks,
+			Store:             store,
+		}
+		registry.Register(checks, settings)
+		a.mutex.Lock()
+		a.compliance = checks
+		a.mutex.Unlock()
+	}
+
+	if storeErr != nil {
+		a.logger.Printf("Query packs disabled: %v", storeErr)
+		return registry
+	}
+	for _, p := range a.config.Packs {
+		for _, q := range p.Queries {
+			c := &pack.Collector{
+				OsqueryInstance:   a.osquery.OsqueryInstance,
+				OsquerySocketPath: a.osquery.OsquerySocketPath,
+				Pack:              p.Name,
+				Query:             q,
+				Store:             store,
+			}
+			registry.Register(c, c.Settings())
+		}
+	}
+
+	return registry
+}
+
+// useNativeBackend reports whether the files, system, network and inventory
+// collectors bypass osquery. With the default "auto" backend that is the case
+// on Linux when the osquery socket could not be found at startup. Elsewhere
+// there is no native backend to fall back to.
+func (a *App) useNativeBackend() bool {
+	switch a.config.Backend {
+	case "native":
+		return true
+	case "osquery":
+		return false
+	default:
+		return runtime.GOOS == "linux" && a.osquery.OsqueryInstance == nil
+	}
+}
+
+// newAnomalyDetector returns nil unless anomaly detection is enabled.
+func (a *App) newAnomalyDetector() *anomaly.Detector {
+	if !a.config.Anomaly.Enabled {
+		return nil
+	}
+	store, err := a.stateStore()
+	if err != nil {
+		a.logger.Printf("Anomaly baselines will not be kept across restarts: %v", err)
+	}
+	detector, err := anomaly.NewDetector(a.config.Anomaly, store, a.logger)
+	if err != nil {
+		a.logger.Printf("Anomaly detection disabled: %v", err)
+		return nil
+	}
+	return detector
+}
+
+func (a *App) stateStore() (*state.Store, error) {
+	dir := a.config.StateDirectory
+	if dir == "" {
+		var err error
+		dir, err = state.DefaultDir()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &state.Store{Dir: dir}, nil
+}
@@ -0,0 +1,251 @@
+package app
+
+import (
+	"context"
+	"daemon/internal/alert"
+	"daemon/internal/anomaly"
+	"daemon/internal/collector"
+	"daemon/internal/compliance"
+	"daemon/internal/file"
+	"daemon/internal/pack"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-playground/validator"
+	"github.com/spf13/viper"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+type Config struct {
+	// MonitorDirectory is the single monitored directory of configs written
+	// before watches existed. When set it becomes the first watch entry,
+	// scanned with Scan.
+	MonitorDirectory string `mapstructure:"monitor_directory" validate:"omitempty,dir"`
+	CheckFrequency   int    `mapstructure:"check_frequency" validate:"required,min=1,max=60"`
+	APIEndpoint      string `mapstructure:"api_endpoint" validate:"required,url"`
+
+	// Scan selects the files reported under monitor_directory.
+	Scan file.Scan `mapstructure:"scan"`
+
+	// Watches are the monitored directories, each with its own scan rules,
+	// schedule and labels.
+	Watches []file.Watch `mapstructure:"watches" validate:"dive"`
+
+	IncludePseudoFilesystems bool     `mapstructure:"include_pseudo_filesystems"`
+	NetworkIncludeInterfaces []string `mapstructure:"network_include_interfaces"`
+	NetworkExcludeInterfaces []string `mapstructure:"network_exclude_interfaces"`
+	TopProcesses             int      `mapstructure:"top_processes" validate:"omitempty,min=1,max=100"`
+
+	// Backend selects where the files, system and network collectors get
+	// their data: osquery, native (Linux only) or auto, the default, which
+	// uses osquery when it could be reached and native otherwise.
+	Backend string `mapstructure:"backend" validate:"omitempty,oneof=auto osquery native"`
+
+	// Collectors overrides the schedule of individual collectors, keyed by
+	// collector name. Collectors without an entry run every check_frequency.
+	Collectors map[string]collector.Settings `mapstructure:"collectors"`
+
+	// Packs are scheduled osquery queries whose results are uploaded with
+	// the built-in stats.
+	Packs []pack.Pack `mapstructure:"packs" validate:"dive"`
+
+	// Alerts are threshold rules evaluated against every sample.
+	Alerts []alert.Rule `mapstructure:"alerts" validate:"dive"`
+
+	// Anomaly flags metrics that stray from their learned baseline.
+	Anomaly anomaly.Settings `mapstructure:"anomaly"`
+
+	// ComplianceFile lists the compliance checks to run, in YAML. A relative
+	// path is resolved against the directory of the config file.
+	ComplianceFile string `mapstructure:"compliance_file"`
+
+	// StateDirectory holds what collectors persist between runs. Defaults
+	// to ~/.daemon/state.
+	StateDirectory string `mapstructure:"state_directory"`
+}
+
+func (a *App) loadConfig(ctx context.Context) error {
+	configPath, err := a.dialog.SaveFileDialog(ctx, runtime.SaveDialogOptions{
+		DefaultFilename: "config.yaml",
+		Title:           "Choose config file location",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get config file path: %w", err)
+	}
+
+	a.logger.Printf("Config file path selected: %s", configPath)
+
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		a.logger.Printf("Config file does not exist, creating default config at: %s", configPath)
+		monitorDirs, err := a.selectMonitorDirectories(ctx)
+		if err != nil {
+			return err
+		}
+		if len(monitorDirs) == 0 {
+			homeDir, err := os.UserHomeDir()
+			if err != nil {
+				return fmt.Errorf("failed to get home directory: %w", err)
+			}
+			monitorDirs = []string{filepath.Join(homeDir, "Documents")}
+			a.logger.Printf("No directory selected. Using default directory: %s", monitorDirs[0])
+		}
+
+		if err := a.createDefaultConfig(configPath, monitorDirs); err != nil {
+			return fmt.Errorf("failed to create default config: %w", err)
+		}
+	}
+
+	return a.readConfig(configPath)
+}
+
+// selectMonitorDirectories asks for directories to monitor until the dialog
+// is cancelled.
+func (a *App) selectMonitorDirectories(ctx context.Context) ([]string, error) {
+	dirs := []string{}
+	seen := map[string]bool{}
+	title := "Select directory to monitor"
+	for {
+		dir, err := a.dialog.OpenDirectoryDialog(ctx, runtime.OpenDialogOptions{
+			Title: title,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to select directory: %w", err)
+		}
+		if dir == "" {
+			return dirs, nil
+		}
+		dir = filepath.Clean(dir)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+			a.logger.Printf("Directory selected: %s", dir)
+		}
+		title = "Select another directory to monitor, or cancel to finish"
+	}
+}
+
+// readConfig loads and validates the config file at configPath.
+func (a *App) readConfig(configPath string) error {
+	a.mutex.Lock()
+	a.configLoaded = false
+	a.mutex.Unlock()
+
+	viper.SetConfigFile(configPath)
+
+	if err := viper.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if err := viper.Unmarshal(&a.config); err != nil {
+		return fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+
+	validate := validator.New()
+	if err := validate.Struct(a.config); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := a.config.normalizeWatches(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := a.config.validateCollectors(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := a.config.validatePacks(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	a.checks = nil
+	if a.config.ComplianceFile != "" {
+		if !filepath.IsAbs(a.config.ComplianceFile) {
+			a.config.ComplianceFile = filepath.Join(filepath.Dir(configPath), a.config.ComplianceFile)
+		}
+		checks, err := compliance.Load(a.config.ComplianceFile)
+		if err != nil {
+			return err
+		}
+		a.checks = checks
+	}
+
+	a.mutex.Lock()
+	a.configLoaded = true
+	a.mutex.Unlock()
+	a.logger.Println("Config loaded successfully")
+	return nil
+}
+
+// normalizeWatches turns monitor_directory into the first watch entry and
+// names the entries that have no name.
+func (c *Config) normalizeWatches() error {
+	if c.MonitorDirectory != "" {
+		c.Watches = append([]file.Watch{{Path: c.MonitorDirectory, Scan: c.Scan}}, c.Watches...)
+		c.MonitorDirectory = ""
+	}
+	if len(c.Watches) == 0 {
+		return fmt.Errorf("no directory to monitor: set watches or monitor_directory")
+	}
+
+	names := map[string]bool{}
+	for i := range c.Watches {
+		w := &c.Watches[i]
+		w.Path = filepath.Clean(w.Path)
+		if w.Name == "" {
+			w.Name = filepath.Base(w.Path)
+		}
+		if names[w.Name] {
+			return fmt.Errorf("duplicate watch name %q", w.Name)
+		}
+		names[w.Name] = true
+		if err := w.Scan.Validate(); err != nil {
+			return fmt.Errorf("watch %q: %w", w.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateCollectors rejects the keys under "collectors" that name no
+// collector, so that a misspelled name is not silently ignored.
+func (c *Config) validateCollectors() error {
+	for name := range c.Collectors {
+		if !slices.Contains(collectorNames, name) {
+			return fmt.Errorf("unknown collector %q, expected one of %s", name, strings.Join(collectorNames, ", "))
+		}
+	}
+	return nil
+}
+
+// validatePacks checks each pack and rejects packs of the same name, which
+// would share their differential state.
+func (c *Config) validatePacks() error {
+	names := map[string]bool{}
+	for _, p := range c.Packs {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+		if names[p.Name] {
+			return fmt.Errorf("duplicate pack name %q", p.Name)
+		}
+		names[p.Name] = true
+	}
+	return nil
+}
+
+func (a *App) createDefaultConfig(configPath string, monitorDirs []string) error {
+	var watches strings.Builder
+	for _, dir := range monitorDirs {
+		// Windows paths need their backslashes escaped in a double quoted
+		// YAML string.
+		dir = strings.ReplaceAll(filepath.Clean(dir), `\`, `\\`)
+		dir = strings.ReplaceAll(dir, `"`, `\"`)
+		fmt.Fprintf(&watches, "  - path: \"%s\"\n", dir)
+	}
+	defaultConfig := fmt.Sprintf(`
+watches:
+%scheck_frequency: 60
+api_endpoint: "https://eo13t4hn4shbd6x.m.pipedream.net"
+`, watches.String())
+
+	return os.WriteFile(configPath, []byte(defaultConfig), 0644)
+}
@@ -0,0 +1,37 @@
+package app
+
+import (
+	"daemon/internal/collector"
+	"daemon/internal/pack"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCollectors(t *testing.T) {
+	c := Config{Collectors: map[string]collector.Settings{
+		"processes": {Interval: time.Minute},
+		"integrity": {Interval: time.Hour},
+	}}
+	assert.NoError(t, c.validateCollectors())
+
+	c.Collectors["proceses"] = collector.Settings{Interval: time.Minute}
+	err := c.validateCollectors()
+	assert.ErrorContains(t, err, `unknown collector "proceses"`)
+}
+
+func TestValidatePacks(t *testing.T) {
+	query := pack.Query{Name: "listeners", SQL: "SELECT port FROM listening_ports"}
+	c := Config{Packs: []pack.Pack{
+		{Name: "security", Queries: []pack.Query{query}},
+		{Name: "inventory", Queries: []pack.Query{query}},
+	}}
+	assert.NoError(t, c.validatePacks())
+
+	c.Packs = append(c.Packs, pack.Pack{Name: "security", Queries: []pack.Query{query}})
+	assert.ErrorContains(t, c.validatePacks(), `duplicate pack name "security"`)
+
+	c.Packs = []pack.Pack{{Name: "..", Queries: []pack.Query{query}}}
+	assert.ErrorContains(t, c.validatePacks(), "invalid pack name")
+}
@@ -0,0 +1,231 @@
+package collector
+
+import (
+	"context"
+	"daemon/internal/file"
+	"daemon/internal/monitor"
+	"daemon/internal/stats"
+	"log"
+	"sync"
+)
+
+// The built-in collectors wrap the osquery backed monitors.
+
+// maxPendingEvents bounds the events a watcher keeps between two runs of
+// the collector. The oldest are dropped first.
+const maxPendingEvents = 1000
+
+type Files struct {
+	File *file.File
+	// Watch and Labels name the watch entry the files are reported under.
+	Watch  string
+	Labels map[string]string
+	// Watcher, when set, reports changes as they happen while RunWatcher
+	// runs, and Collect only hands over what it reported since the last
+	// call.
+	Watcher *file.Watcher
+
+	mutex    sync.Mutex
+	polling  bool
+	scanned  bool
+	baseline bool
+	count    int
+	pending  []file.Event
+}
+
+func (c *Files) Name() string { return "files:" + c.Watch }
+
+// RunWatcher runs Watcher until ctx is done. If the watcher cannot start,
+// Collect goes back to scanning.
+func (c *Files) RunWatcher(ctx context.Context, logger *log.Logger) {
+	err := c.Watcher.Run(ctx, c.addChanges)
+	if err != nil {
+		logger.Printf("Falling back to polling %s: %v", c.File.MonitorDirectory, err)
+		c.mutex.Lock()
+		c.polling = true
+		c.mutex.Unlock()
+	}
+}
+
+// addChanges keeps what the watcher reported until the next Collect.
+func (c *Files) addChanges(changes *file.Changes) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.scanned = true
+	c.baseline = c.baseline || changes.Baseline
+	c.count = changes.FileCount
+	c.pending = append(c.pending, changes.Events...)
+	if len(c.pending) > maxPendingEvents {
+		c.pending = c.pending[len(c.pending)-maxPendingEvents:]
+	}
+}
+
+func (c *Files) Collect(ctx context.Context) (Result, error) {
+	changes, err := c.changes()
+	if err != nil || changes == nil {
+		return nil, err
+	}
+
+	var modified *int
+	if !changes.Baseline {
+		count := 0
+		for _, e := range changes.Events {
+			if e.Type == file.FileCreated || e.Type == file.FileModified {
+				count++
+			}
+		}
+		modified = &count
+	}
+
+	return func(s *stats.Sample) {
+		s.Watches = append(s.Watches, stats.WatchStats{
+			Name:          c.Watch,
+			Path:          c.File.MonitorDirectory,
+			Labels:        c.Labels,
+			FileCount:     changes.FileCount,
+			FilesModified: modified,
+			Events:        changes.Events,
+		})
+		if modified != nil {
+			if s.FilesModified == nil {
+				s.FilesModified = new(int)
+			}
+			*s.FilesModified += *modified
+		}
+	}, nil
+}
+
+// changes scans, or takes what the watcher reported. It returns nil while
+// the watcher has not finished its first scan.
+func (c *Files) changes() (*file.Changes, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.Watcher == nil || c.polling {
+		return c.File.GetFileChanges()
+	}
+	if !c.scanned {
+		return nil, nil
+	}
+
+	changes := &file.Changes{
+		FileCount: c.count,
+		Events:    c.pending,
+		Baseline:  c.baseline,
+	}
+	if changes.Events == nil {
+		changes.Events = []file.Event{}
+	}
+	c.pending = nil
+	c.baseline = false
+	return changes, nil
+}
+
+// Integrity checks the files of one watch entry against their baseline.
+type Integrity struct {
+	Integrity *file.Integrity
+	Watch     string
+	Labels    map[string]string
+}
+
+func (c *Integrity) Name() string { return "integrity:" + c.Watch }
+
+func (c *Integrity) Collect(ctx context.Context) (Result, error) {
+	report, err := c.Integrity.Check()
+	if err != nil {
+		return nil, err
+	}
+	return func(s *stats.Sample) {
+		s.Integrity = append(s.Integrity, stats.IntegrityStats{
+			Name:            c.Watch,
+			Path:            c.Integrity.File.MonitorDirectory,
+			Labels:          c.Labels,
+			IntegrityReport: *report,
+		})
+	}, nil
+}
+
+type System struct {
+	Monitor *monitor.Monitor
+}
+
+func (c *System) Name() string { return "system" }
+
+func (c *System) Collect(ctx context.Context) (Result, error) {
+	system, err := c.Monitor.GetSystemMonitoringData()
+	if err != nil {
+		return nil, err
+	}
+	return func(s *stats.Sample) { s.System = system }, nil
+}
+
+type Network struct {
+	Network *monitor.Network
+}
+
+func (c *Network) Name() string { return "network" }
+
+func (c *Network) Collect(ctx context.Context) (Result, error) {
+	network, err := c.Network.GetNetworkStats()
+	if err != nil {
+		return nil, err
+	}
+	return func(s *stats.Sample) { s.Network = network }, nil
+}
+
+type Processes struct {
+	Processes *monitor.Processes
+}
+
+func (c *Processes) Name() string { return "processes" }
+
+func (c *Processes) Collect(ctx context.Context) (Result, error) {
+	processes, err := c.Processes.GetProcessStats()
+	if err != nil {
+		return nil, err
+	}
+	return func(s *stats.Sample) { s.Processes = processes }, nil
+}
+
+type Sockets struct {
+	Sockets *monitor.Sockets
+}
+
+func (c *Sockets) Name() string { return "sockets" }
+
+func (c *Sockets) Collect(ctx context.Context) (Result, error) {
+	sockets, err := c.Sockets.GetSocketStats()
+	if err != nil {
+		return nil, err
+	}
+	return func(s *stats.Sample) { s.Sockets = sockets }, nil
+}
+
+type Inventory struct {
+	Inventory *monitor.Inventory
+}
+
+func (c *Inventory) Name() string { return "inventory" }
+
+func (c *Inventory) Collect(ctx context.Context) (Result, error) {
+	inventory, err := c.Inventory.GetHostInventory()
+	if err != nil {
+		return nil, err
+	}
+	return func(s *stats.Sample) { s.Inventory = inventory }, nil
+}
+
+type Software struct {
+	Software *monitor.Software
+}
+
+func (c *Software) Name() string { return "software" }
+
+func (c *Software) Collect(ctx context.Context) (Result, error) {
+	software, err := c.Software.GetSoftwareStats()
+	if err != nil {
+		return nil, err
+	}
+	return func(s *stats.Sample) { s.Software = software }, nil
+}
+
+func (c *Software) Commit() error { return c.Software.Commit() }
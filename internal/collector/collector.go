@@ -0,0 +1,271 @@
+package collector
+
+import (
+	"context"
+	"daemon/internal/stats"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Collector gathers one section of a stats.Sample.
+//
+// Collect may be abandoned when it exceeds its timeout, so it must not touch
+// the sample directly. It returns a Result instead, which the registry
+// applies once every collector due in the tick has finished. A Result that
+// comes in after the timeout is applied on the next tick, since the
+// collector may already have saved the state it was computed against.
+type Collector interface {
+	Name() string
+	Collect(ctx context.Context) (Result, error)
+}
+
+// Result merges a collector's output into the sample of the current tick.
+type Result func(sample *stats.Sample)
+
+// Committer is a Collector that reports changes against state it keeps
+// between runs. Collect leaves the new state pending and Commit saves it,
+// once the sample holding the result was delivered. Until then every run
+// compares with the last committed state, so changes that were not
+// delivered are reported again rather than lost.
+type Committer interface {
+	Commit() error
+}
+
+// Settings controls a single collector. Zero values fall back to the
+// registry defaults.
+type Settings struct {
+	Enabled  *bool         `mapstructure:"enabled"`
+	Interval time.Duration `mapstructure:"interval"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+}
+
+type entry struct {
+	collector Collector
+	interval  time.Duration
+	timeout   time.Duration
+	next      time.Time
+	running   bool
+	// timedOut is set while an abandoned run is still going, and late holds
+	// its result once it finished, until the next tick takes it.
+	timedOut bool
+	late     Result
+}
+
+type outcome struct {
+	result Result
+	err    error
+}
+
+// Registry schedules collectors independently of each other. Each one runs
+// on its own interval, and a failing or slow collector only loses its own
+// section of the sample.
+type Registry struct {
+	defaults Settings
+	logger   *log.Logger
+
+	mutex   sync.Mutex
+	entries []*entry
+	// uncommitted are the collectors whose results are in the last sample.
+	uncommitted []Collector
+}
+
+func NewRegistry(defaults Settings, logger *log.Logger) *Registry {
+	if defaults.Interval <= 0 {
+		defaults.Interval = time.Minute
+	}
+	if defaults.Timeout <= 0 {
+		defaults.Timeout = 30 * time.Second
+	}
+	return &Registry{defaults: defaults, logger: logger}
+}
+
+// Register adds c unless its settings disable it, and reports whether it
+// did. Collectors registered first are applied to the sample first.
+func (r *Registry) Register(c Collector, settings Settings) bool {
+	if settings.Enabled != nil && !*settings.Enabled {
+		r.logger.Printf("Collector %s disabled", c.Name())
+		return false
+	}
+
+	e := &entry{
+		collector: c,
+		interval:  settings.Interval,
+		timeout:   settings.Timeout,
+	}
+	if e.interval <= 0 {
+		e.interval = r.defaults.Interval
+	}
+	if e.timeout <= 0 {
+		e.timeout = r.defaults.Timeout
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.entries = append(r.entries, e)
+	return true
+}
+
+// jitter is how early a collector may run. Ticks arrive a little late and
+// not always by the same amount, so without it a tick that comes slightly
+// earlier than the previous one would skip a whole interval.
+func jitter(interval time.Duration) time.Duration {
+	return min(interval/10, 500*time.Millisecond)
+}
+
+// Names lists the registered collectors in registration order.
+func (r *Registry) Names() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	names := make([]string, 0, len(r.entries))
+	for _, e := range r.entries {
+		names = append(names, e.collector.Name())
+	}
+	return names
+}
+
+// Collect runs every collector that is due at now, in parallel, and merges
+// their results into a new sample. It returns nil when nothing was due.
+func (r *Registry) Collect(ctx context.Context, now time.Time) *stats.Sample {
+	r.mutex.Lock()
+	var due []*entry
+	late := map[*entry]Result{}
+	for _, e := range r.entries {
+		// The result of a run that overran stands in for this tick's run,
+		// so that the sample holds one result per collector.
+		if e.late != nil {
+			late[e] = e.late
+			e.late = nil
+			due = append(due, e)
+			continue
+		}
+		if now.Add(jitter(e.interval)).Before(e.next) {
+			continue
+		}
+		// Keep to the schedule rather than to when the tick arrived, unless
+		// the collector fell more than an interval behind.
+		e.next = e.next.Add(e.interval)
+		if !e.next.After(now) {
+			e.next = now.Add(e.interval)
+		}
+		due = append(due, e)
+	}
+	r.mutex.Unlock()
+
+	if len(due) == 0 {
+		return nil
+	}
+
+	outcomes := make([]outcome, len(due))
+	var wg sync.WaitGroup
+	for i, e := range due {
+		if result, ok := late[e]; ok {
+			r.logger.Printf("Collector %s finished after its timeout", e.collector.Name())
+			outcomes[i] = outcome{result: result}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, e *entry) {
+			defer wg.Done()
+			result, err := r.run(ctx, e)
+			outcomes[i] = outcome{result, err}
+		}(i, e)
+	}
+	wg.Wait()
+
+	sample := stats.NewSample(now)
+	var uncommitted []Collector
+	for i, e := range due {
+		name := e.collector.Name()
+		if err := outcomes[i].err; err != nil {
+			r.logger.Printf("Collector %s failed: %v", name, err)
+			if sample.Errors == nil {
+				sample.Errors = map[string]string{}
+			}
+			sample.Errors[name] = err.Error()
+			continue
+		}
+		if outcomes[i].result != nil {
+			outcomes[i].result(sample)
+		}
+		if _, ok := e.collector.(Committer); ok {
+			uncommitted = append(uncommitted, e.collector)
+		}
+	}
+
+	r.mutex.Lock()
+	r.uncommitted = uncommitted
+	r.mutex.Unlock()
+	return sample
+}
+
+// Commit saves the state of the collectors whose results are in the sample
+// Collect returned last. Call it once that sample was delivered.
+func (r *Registry) Commit() {
+	r.mutex.Lock()
+	uncommitted := r.uncommitted
+	r.uncommitted = nil
+	r.mutex.Unlock()
+
+	for _, c := range uncommitted {
+		if err := c.(Committer).Commit(); err != nil {
+			r.logger.Printf("Collector %s could not save its state: %v", c.Name(), err)
+		}
+	}
+}
+
+// run calls the collector with a timeout. A collector that overruns keeps
+// its goroutine until it returns, and is skipped on later ticks until then
+// so that it never runs twice at once. If it then succeeds, its result is
+// kept for the next tick.
+func (r *Registry) run(ctx context.Context, e *entry) (Result, error) {
+	r.mutex.Lock()
+	if e.running {
+		r.mutex.Unlock()
+		return nil, fmt.Errorf("previous run still in progress")
+	}
+	e.running = true
+	r.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := e.collector.Collect(ctx)
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		e.running = false
+		if e.timedOut {
+			e.timedOut = false
+			if err == nil && result != nil {
+				e.late = result
+			}
+			return
+		}
+		done <- outcome{result, err}
+	}()
+
+	select {
+	case o := <-done:
+		return o.result, o.err
+	case <-ctx.Done():
+	}
+
+	// The run may have finished while the deadline passed.
+	r.mutex.Lock()
+	select {
+	case o := <-done:
+		r.mutex.Unlock()
+		return o.result, o.err
+	default:
+		e.timedOut = true
+		r.mutex.Unlock()
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, fmt.Errorf("timed out after %s", e.timeout)
+	}
+	return nil, ctx.Err()
+}
@@ -0,0 +1,179 @@
+package collector
+
+import (
+	"context"
+	"daemon/internal/file"
+	"daemon/internal/monitor"
+	"daemon/internal/stats"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeCollector struct {
+	name   string
+	delay  time.Duration
+	err    error
+	result Result
+	calls  int
+}
+
+func (c *fakeCollector) Name() string { return c.name }
+
+func (c *fakeCollector) Collect(ctx context.Context) (Result, error) {
+	c.calls++
+	time.Sleep(c.delay)
+	return c.result, c.err
+}
+
+type fakeCommitter struct {
+	fakeCollector
+	commits int
+}
+
+func (c *fakeCommitter) Commit() error {
+	c.commits++
+	return nil
+}
+
+func TestRegistryCommitsDeliveredResults(t *testing.T) {
+	registry := NewRegistry(Settings{Interval: time.Second}, log.New(io.Discard, "", 0))
+	ok := &fakeCommitter{fakeCollector: fakeCollector{name: "ok"}}
+	broken := &fakeCommitter{fakeCollector: fakeCollector{name: "broken", err: errors.New("osquery down")}}
+	registry.Register(ok, Settings{})
+	registry.Register(broken, Settings{})
+	registry.Register(&fakeCollector{name: "plain"}, Settings{})
+
+	start := time.Now()
+	require.NotNil(t, registry.Collect(context.Background(), start))
+	registry.Commit()
+	assert.Equal(t, 1, ok.commits)
+	assert.Equal(t, 0, broken.commits, "a failed run has nothing to commit")
+
+	// A sample that was not delivered is not committed.
+	require.NotNil(t, registry.Collect(context.Background(), start.Add(time.Second)))
+	require.NotNil(t, registry.Collect(context.Background(), start.Add(2*time.Second)))
+	registry.Commit()
+	registry.Commit()
+	assert.Equal(t, 2, ok.commits)
+}
+
+func TestRegistryIsolatesFailures(t *testing.T) {
+	registry := NewRegistry(Settings{Interval: time.Second, Timeout: 50 * time.Millisecond}, log.New(io.Discard, "", 0))
+
+	network := &monitor.NetworkStats{}
+	registry.Register(&fakeCollector{name: "broken", err: errors.New("osquery down")}, Settings{})
+	registry.Register(&fakeCollector{name: "slow", delay: 200 * time.Millisecond}, Settings{})
+	registry.Register(&fakeCollector{name: "network", result: func(s *stats.Sample) { s.Network = network }}, Settings{})
+
+	sample := registry.Collect(context.Background(), time.Now())
+	require.NotNil(t, sample)
+	assert.Same(t, network, sample.Network)
+	assert.Equal(t, "osquery down", sample.Errors["broken"])
+	assert.Contains(t, sample.Errors["slow"], "timed out")
+}
+
+func TestRegistryKeepsLateResults(t *testing.T) {
+	registry := NewRegistry(Settings{Interval: time.Hour, Timeout: 50 * time.Millisecond}, log.New(io.Discard, "", 0))
+	software := &monitor.SoftwareStats{}
+	registry.Register(&fakeCollector{name: "software", delay: 150 * time.Millisecond, result: func(s *stats.Sample) { s.Software = software }}, Settings{})
+
+	start := time.Now()
+	sample := registry.Collect(context.Background(), start)
+	require.NotNil(t, sample)
+	assert.Contains(t, sample.Errors["software"], "timed out")
+	assert.Nil(t, sample.Software)
+
+	// The run still finishes, and its result goes out with the next tick
+	// although the collector is not due again for an hour.
+	assert.Eventually(t, func() bool {
+		sample = registry.Collect(context.Background(), start.Add(time.Second))
+		return sample != nil
+	}, time.Second, 20*time.Millisecond)
+	assert.Same(t, software, sample.Software)
+	assert.Empty(t, sample.Errors)
+	assert.Nil(t, registry.Collect(context.Background(), start.Add(2*time.Second)))
+}
+
+func TestRegistrySchedulesIndependently(t *testing.T) {
+	registry := NewRegistry(Settings{Interval: time.Second}, log.New(io.Discard, "", 0))
+
+	fast := &fakeCollector{name: "fast"}
+	slow := &fakeCollector{name: "slow"}
+	disabled := false
+	assert.True(t, registry.Register(fast, Settings{}))
+	assert.True(t, registry.Register(slow, Settings{Interval: 10 * time.Second}))
+	assert.False(t, registry.Register(&fakeCollector{name: "off"}, Settings{Enabled: &disabled}))
+	assert.Equal(t, []string{"fast", "slow"}, registry.Names())
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		assert.NotNil(t, registry.Collect(context.Background(), start.Add(time.Duration(i)*time.Second)))
+	}
+	assert.Equal(t, 5, fast.calls)
+	assert.Equal(t, 1, slow.calls)
+
+	// A tick arriving a little earlier relative to the schedule than the
+	// last one must not skip the interval.
+	registry.Collect(context.Background(), start.Add(5*time.Second+20*time.Millisecond))
+	registry.Collect(context.Background(), start.Add(6*time.Second+5*time.Millisecond))
+	assert.Equal(t, 7, fast.calls)
+}
+
+func TestFilesGroupsByWatch(t *testing.T) {
+	documents, desktop := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(documents, "report.docx"), nil, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(desktop, "todo.txt"), nil, 0644))
+
+	registry := NewRegistry(Settings{Interval: time.Second}, log.New(io.Discard, "", 0))
+	registry.Register(&Files{File: &file.File{MonitorDirectory: documents, Native: true}, Watch: "Documents"}, Settings{})
+	registry.Register(&Files{File: &file.File{MonitorDirectory: desktop, Native: true}, Watch: "Desktop", Labels: map[string]string{"kind": "local"}}, Settings{})
+
+	start := time.Now()
+	sample := registry.Collect(context.Background(), start)
+	require.NotNil(t, sample)
+	require.Len(t, sample.Watches, 2)
+	assert.Equal(t, "Documents", sample.Watches[0].Name)
+	assert.Equal(t, 1, sample.Watches[0].FileCount)
+	assert.Empty(t, sample.Watches[0].Events)
+	assert.Nil(t, sample.Watches[0].FilesModified)
+	assert.Equal(t, map[string]string{"kind": "local"}, sample.Watches[1].Labels)
+	assert.Nil(t, sample.FilesModified)
+
+	require.NoError(t, os.WriteFile(filepath.Join(documents, "draft.docx"), []byte("x"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(desktop, "new.txt"), []byte("x"), 0644))
+
+	sample = registry.Collect(context.Background(), start.Add(time.Second))
+	require.NotNil(t, sample)
+	require.Len(t, sample.Watches, 2)
+	require.Len(t, sample.Watches[0].Events, 1)
+	assert.Equal(t, file.FileCreated, sample.Watches[0].Events[0].Type)
+	assert.Equal(t, filepath.Join(documents, "draft.docx"), sample.Watches[0].Events[0].Path)
+	require.NotNil(t, sample.FilesModified)
+	assert.Equal(t, 2, *sample.FilesModified)
+}
+
+func TestFilesBoundsPendingEvents(t *testing.T) {
+	files := &Files{File: &file.File{}, Watch: "Documents", Watcher: &file.Watcher{}}
+	for i := 0; i < maxPendingEvents+10; i++ {
+		files.addChanges(&file.Changes{FileCount: i, Events: []file.Event{{Type: file.FileCreated, Path: strconv.Itoa(i)}}})
+	}
+
+	changes, err := files.changes()
+	require.NoError(t, err)
+	require.Len(t, changes.Events, maxPendingEvents)
+	assert.Equal(t, "10", changes.Events[0].Path, "the oldest events are dropped")
+	assert.Equal(t, maxPendingEvents+9, changes.FileCount)
+
+	changes, err = files.changes()
+	require.NoError(t, err)
+	assert.Empty(t, changes.Events)
+}
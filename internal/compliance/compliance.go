@@ -0,0 +1,272 @@
+package compliance
+
+import (
+	"context"
+	"daemon/internal/collector"
+	"daemon/internal/state"
+	"daemon/internal/stats"
+	"fmt"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator"
+	"github.com/osquery/osquery-go"
+	"github.com/spf13/viper"
+)
+
+const (
+	RowsSome = "some"
+	RowsNone = "none"
+)
+
+// historySize is how many reports are kept, in memory and in the state
+// directory.
+const historySize = 100
+
+const historyStateName = "compliance/history"
+
+// Check is one compliance rule: an osquery statement and the outcome a
+// compliant host produces.
+type Check struct {
+	ID       string `mapstructure:"id" validate:"required"`
+	Title    string `mapstructure:"title" validate:"required"`
+	Severity string `mapstructure:"severity"`
+	// Platform limits the check to one of linux, darwin or windows.
+	Platform string `mapstructure:"platform" validate:"omitempty,oneof=linux darwin windows"`
+	SQL      string `mapstructure:"sql" validate:"required"`
+	Expect   Expect `mapstructure:"expect"`
+}
+
+// Expect is the outcome of a passing check. Without a column the check only
+// looks at whether rows came back. With a column, at least one row must come
+// back and the column of every row must compare true against Value.
+type Expect struct {
+	// Rows is some, the default, or none.
+	Rows     string `mapstructure:"rows" validate:"omitempty,oneof=some none"`
+	Column   string `mapstructure:"column"`
+	Operator string `mapstructure:"operator" validate:"omitempty,oneof=== != > >= < <= matches"`
+	Value    string `mapstructure:"value"`
+}
+
+// File is the layout of the compliance checks file.
+type File struct {
+	Checks []Check `mapstructure:"checks" validate:"dive"`
+}
+
+// Load reads and validates the checks in a YAML (or JSON, or TOML) file.
+func Load(path string) ([]Check, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read compliance file: %w", err)
+	}
+
+	var file File
+	if err := v.Unmarshal(&file); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal compliance file: %w", err)
+	}
+	if err := validator.New().Struct(file); err != nil {
+		return nil, fmt.Errorf("invalid compliance file: %w", err)
+	}
+
+	ids := map[string]bool{}
+	for _, check := range file.Checks {
+		if ids[check.ID] {
+			return nil, fmt.Errorf("invalid compliance file: duplicate check id %q", check.ID)
+		}
+		ids[check.ID] = true
+
+		expect := check.Expect
+		if expect.Column != "" && expect.Operator == "" {
+			return nil, fmt.Errorf("invalid compliance file: check %q compares column %q without an operator", check.ID, expect.Column)
+		}
+		if expect.Column != "" && expect.Rows == RowsNone {
+			return nil, fmt.Errorf("invalid compliance file: check %q expects no rows but compares column %q", check.ID, expect.Column)
+		}
+		if expect.Operator == "matches" {
+			if _, err := regexp.Compile(expect.Value); err != nil {
+				return nil, fmt.Errorf("invalid compliance file: check %q: %w", check.ID, err)
+			}
+		}
+	}
+	return file.Checks, nil
+}
+
+// Collector runs every check for the current platform and keeps the latest
+// reports. History is saved in Store, when set, so it survives a restart.
+type Collector struct {
+	OsqueryInstance   *osquery.ExtensionManagerServer
+	OsquerySocketPath string
+	Checks            []Check
+	Store             *state.Store
+
+	mutex   sync.Mutex
+	history []stats.ComplianceReport
+	loaded  bool
+}
+
+func (c *Collector) Name() string { return "compliance" }
+
+func (c *Collector) Collect(ctx context.Context) (collector.Result, error) {
+	if c.OsqueryInstance == nil {
+		return nil, fmt.Errorf("osquery instance not initialized")
+	}
+
+	client, err := osquery.NewClient(c.OsquerySocketPath, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create osquery client: %w", err)
+	}
+	defer client.Close()
+
+	report := stats.ComplianceReport{Time: time.Now().UTC(), Results: []stats.CheckResult{}}
+	for _, check := range c.Checks {
+		if check.Platform != "" && check.Platform != runtime.GOOS {
+			continue
+		}
+
+		result := stats.CheckResult{ID: check.ID, Title: check.Title, Severity: check.Severity}
+		response, err := client.QueryContext(ctx, check.SQL)
+		if err == nil && response.GetStatus() != nil && response.GetStatus().Code != 0 {
+			err = fmt.Errorf("%s", response.GetStatus().Message)
+		}
+		if err != nil {
+			result.Status = stats.CheckError
+			result.Message = fmt.Sprintf("query failed: %v", err)
+		} else {
+			result.Status, result.Message = Evaluate(check.Expect, response.Response)
+		}
+
+		switch result.Status {
+		case stats.CheckPass:
+			report.Passed++
+		case stats.CheckFail:
+			report.Failed++
+		default:
+			report.Errors++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	if err := c.record(report); err != nil {
+		return nil, err
+	}
+	return func(s *stats.Sample) { s.Compliance = &report }, nil
+}
+
+// History returns the latest reports, oldest first.
+func (c *Collector) History() []stats.ComplianceReport {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.loaded {
+		c.load()
+	}
+	return append([]stats.ComplianceReport(nil), c.history...)
+}
+
+func (c *Collector) record(report stats.ComplianceReport) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.loaded {
+		c.load()
+	}
+
+	c.history = append(c.history, report)
+	if len(c.history) > historySize {
+		c.history = c.history[len(c.history)-historySize:]
+	}
+	if c.Store == nil {
+		return nil
+	}
+	return c.Store.Save(historyStateName, c.history)
+}
+
+// load restores the saved history. A history that cannot be read is
+// dropped rather than stopping the checks. It must be called with the mutex
+// held.
+func (c *Collector) load() {
+	c.loaded = true
+	if c.Store == nil {
+		return
+	}
+	if _, err := c.Store.Load(historyStateName, &c.history); err != nil {
+		c.history = nil
+	}
+}
+
+// Evaluate decides whether the rows a check returned are compliant, and
+// explains why not.
+func Evaluate(expect Expect, rows []map[string]string) (status, message string) {
+	if expect.Rows == RowsNone {
+		if len(rows) > 0 {
+			return stats.CheckFail, fmt.Sprintf("expected no rows, got %d", len(rows))
+		}
+		return stats.CheckPass, ""
+	}
+	if len(rows) == 0 {
+		return stats.CheckFail, "expected rows, got none"
+	}
+	if expect.Column == "" {
+		return stats.CheckPass, ""
+	}
+
+	for i, row := range rows {
+		value, ok := row[expect.Column]
+		if !ok {
+			return stats.CheckError, fmt.Sprintf("column %q not in result", expect.Column)
+		}
+		match, err := compare(value, expect.Operator, expect.Value)
+		if err != nil {
+			return stats.CheckError, err.Error()
+		}
+		if !match {
+			return stats.CheckFail, fmt.Sprintf("row %d: %s is %q, expected %s %q", i+1, expect.Column, value, expect.Operator, expect.Value)
+		}
+	}
+	return stats.CheckPass, ""
+}
+
+// compare compares numerically when both sides are numbers and as strings
+// otherwise.
+func compare(value, operator, expected string) (bool, error) {
+	if operator == "matches" {
+		re, err := regexp.Compile(expected)
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(value), nil
+	}
+
+	a, errA := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	b, errB := strconv.ParseFloat(strings.TrimSpace(expected), 64)
+	cmp := 0
+	if errA == nil && errB == nil {
+		switch {
+		case a < b:
+			cmp = -1
+		case a > b:
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(value, expected)
+	}
+
+	switch operator {
+	case "==":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	}
+	return false, fmt.Errorf("unknown operator %q", operator)
+}
@@ -0,0 +1,74 @@
+package compliance
+
+import (
+	"daemon/internal/stats"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checks.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+checks:
+  - id: no-empty-passwords
+    title: No account has an empty password
+    severity: high
+    platform: linux
+    sql: SELECT username FROM shadow WHERE password_status = 'empty'
+    expect:
+      rows: none
+  - id: disk-encrypted
+    title: The boot volume is encrypted
+    sql: SELECT encrypted FROM disk_encryption
+    expect:
+      column: encrypted
+      operator: "=="
+      value: "1"
+`), 0644))
+
+	checks, err := Load(path)
+	require.NoError(t, err)
+	require.Len(t, checks, 2)
+	assert.Equal(t, "no-empty-passwords", checks[0].ID)
+	assert.Equal(t, RowsNone, checks[0].Expect.Rows)
+	assert.Equal(t, "encrypted", checks[1].Expect.Column)
+
+	require.NoError(t, os.WriteFile(path, []byte(`
+checks:
+  - id: missing-operator
+    title: Column without an operator
+    sql: SELECT 1 AS one
+    expect:
+      column: one
+`), 0644))
+	_, err = Load(path)
+	assert.Error(t, err)
+}
+
+func TestEvaluate(t *testing.T) {
+	rows := []map[string]string{{"encrypted": "1", "name": "/dev/sda1"}, {"encrypted": "0", "name": "/dev/sdb1"}}
+
+	status, _ := Evaluate(Expect{}, rows)
+	assert.Equal(t, stats.CheckPass, status)
+	status, _ = Evaluate(Expect{}, nil)
+	assert.Equal(t, stats.CheckFail, status)
+
+	status, message := Evaluate(Expect{Rows: RowsNone}, rows)
+	assert.Equal(t, stats.CheckFail, status)
+	assert.Equal(t, "expected no rows, got 2", message)
+
+	status, message = Evaluate(Expect{Column: "encrypted", Operator: "==", Value: "1"}, rows)
+	assert.Equal(t, stats.CheckFail, status)
+	assert.Equal(t, `row 2: encrypted is "0", expected == "1"`, message)
+
+	status, _ = Evaluate(Expect{Column: "encrypted", Operator: ">=", Value: "0"}, rows)
+	assert.Equal(t, stats.CheckPass, status)
+	status, _ = Evaluate(Expect{Column: "name", Operator: "matches", Value: `^/dev/sd[a-z]\d$`}, rows)
+	assert.Equal(t, stats.CheckPass, status)
+	status, _ = Evaluate(Expect{Column: "missing", Operator: "==", Value: "1"}, rows)
+	assert.Equal(t, stats.CheckError, status)
+}
@@ -0,0 +1,424 @@
+package file
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	FileCreated  = "created"
+	FileModified = "modified"
+	FileDeleted  = "deleted"
+	// FileRenamed is a deleted and a created path that turn out to be the
+	// same file: the same inode, size and mtime where the platform has
+	// inodes, or else the same name, size and mtime in another directory.
+	FileRenamed = "renamed"
+)
+
+// Event is a change to one entry between two scans of a directory.
+type Event struct {
+	Type string `json:"type"`
+	Path string `json:"path"`
+	// OldPath is set for renames.
+	OldPath string `json:"old_path,omitempty"`
+	// OldSize is null for created files and NewSize for deleted ones.
+	OldSize *int64 `json:"old_size"`
+	NewSize *int64 `json:"new_size"`
+	// ModifiedTime is the last mtime seen, before the deletion for deleted
+	// files.
+	ModifiedTime time.Time `json:"mtime"`
+}
+
+// Changes is the result of a scan: what changed since the previous one.
+type Changes struct {
+	// Files is the full listing, and only set by GetFileChanges.
+	Files     []FileInfo
+	FileCount int
+	Events    []Event
+	// Baseline is true when there was no previous scan to compare with, so
+	// Events is empty.
+	Baseline bool
+	// Directories and RemovedDirectories are the directories that were
+	// scanned for the first time or have gone, for a Watcher to follow.
+	Directories        []string
+	RemovedDirectories []string
+}
+
+// snapshotEntry is what is kept of each entry between scans.
+type snapshotEntry struct {
+	Size  int64  `json:"size"`
+	MTime int64  `json:"mtime"`
+	Inode uint64 `json:"inode,omitempty"`
+	Dir   bool   `json:"dir,omitempty"`
+}
+
+type snapshot struct {
+	Entries map[string]snapshotEntry `json:"entries"`
+}
+
+func snapshotEntryOf(e entry) snapshotEntry {
+	return snapshotEntry{
+		Size:  e.Size,
+		MTime: e.ModifiedTime.Unix(),
+		Inode: e.inode,
+		Dir:   e.dir,
+	}
+}
+
+// GetFileChanges scans MonitorDirectory and compares the listing with the
+// previous scan. The listing is kept in Store, when set, so changes made
+// while the daemon was down are reported after a restart.
+func (a *File) GetFileChanges() (*Changes, error) {
+	a.scanMutex.Lock()
+	defer a.scanMutex.Unlock()
+
+	entries, dirs, unlisted, err := a.list()
+	if err != nil {
+		return nil, err
+	}
+
+	curr := snapshot{Entries: make(map[string]snapshotEntry, len(entries))}
+	files := make([]FileInfo, 0, len(entries))
+	for _, e := range entries {
+		files = append(files, e.FileInfo)
+		curr.Entries[e.Path] = snapshotEntryOf(e)
+	}
+
+	if a.prev == nil && a.Store != nil {
+		var saved snapshot
+		found, err := a.Store.Load(a.stateName(), &saved)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			a.prev = &saved
+		}
+	}
+
+	// What was below a directory that could not be listed this time is
+	// carried over instead of reported as deleted.
+	if a.prev != nil && len(unlisted) > 0 {
+		for path, e := range a.prev.Entries {
+			if _, ok := curr.Entries[path]; !ok && within(path, unlisted) {
+				curr.Entries[path] = e
+			}
+		}
+	}
+
+	changes := &Changes{Files: files, FileCount: len(files), Baseline: a.prev == nil}
+	if a.prev != nil {
+		changes.Events = diffSnapshots(a.prev, &curr)
+	} else {
+		changes.Events = []Event{}
+	}
+
+	known := a.dirs
+	a.dirs = make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		a.dirs[dir] = true
+		if !known[dir] {
+			changes.Directories = append(changes.Directories, dir)
+		}
+	}
+	for dir := range known {
+		if !a.dirs[dir] && within(dir, unlisted) {
+			a.dirs[dir] = true
+		}
+		if !a.dirs[dir] {
+			changes.RemovedDirectories = append(changes.RemovedDirectories, dir)
+		}
+	}
+
+	a.prev = &curr
+	if err := a.save(); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// RescanDirectories lists only dirs, and any directory that appeared below
+// them, and compares that part of the tree with the previous scan. seen
+// holds the files observed being created since then, nil when they were
+// gone before they could be examined: the ones that are gone are reported
+// as created and deleted, so short-lived files are not missed. It needs a
+// previous scan by GetFileChanges.
+func (a *File) RescanDirectories(dirs []string, seen map[string]*FileInfo) (*Changes, error) {
+	a.scanMutex.Lock()
+	defer a.scanMutex.Unlock()
+
+	if a.prev == nil {
+		return nil, fmt.Errorf("no previous scan to compare with")
+	}
+
+	curr := snapshot{Entries: map[string]snapshotEntry{}}
+	listed := map[string]bool{}
+	present := map[string]bool{}
+	err := a.withBackend(func(b backend) error {
+		for _, dir := range dirs {
+			depth := a.depthOf(dir)
+			if depth < 0 || listed[dir] || (dir != a.MonitorDirectory && !a.dirs[dir]) {
+				continue
+			}
+			// Known subdirectories are rescanned when they report changes
+			// of their own, new ones are scanned in full.
+			entries, subdirs, unlisted, err := a.walk(b.list, []string{dir}, depth, func(sub string) bool {
+				return !a.dirs[sub]
+			})
+			if err != nil {
+				// Gone: the rescan of its parent reports it.
+				continue
+			}
+			listed[dir] = true
+			for _, sub := range subdirs {
+				present[sub] = true
+				if !a.dirs[sub] && !within(sub, unlisted) {
+					listed[sub] = true
+				}
+			}
+			for _, e := range entries {
+				curr.Entries[e.Path] = snapshotEntryOf(e)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A known directory missing from its listed parent is gone with
+	// everything below it.
+	var gone []string
+	for dir := range a.dirs {
+		if listed[filepath.Dir(dir)] && !present[dir] {
+			gone = append(gone, dir)
+		}
+	}
+	prev := snapshot{Entries: map[string]snapshotEntry{}}
+	for path, e := range a.prev.Entries {
+		if listed[filepath.Dir(path)] || within(path, gone) {
+			prev.Entries[path] = e
+		}
+	}
+
+	changes := &Changes{Events: diffSnapshots(&prev, &curr)}
+	for path, info := range seen {
+		if _, ok := a.prev.Entries[path]; ok {
+			continue
+		}
+		if _, ok := curr.Entries[path]; ok {
+			continue
+		}
+		depth := a.depthOf(filepath.Dir(path))
+		if depth < 0 {
+			continue
+		}
+		if report, _ := a.filter(entry{FileInfo: FileInfo{Path: path}}, depth); !report {
+			continue
+		}
+		created := Event{Type: FileCreated, Path: path, ModifiedTime: time.Now().UTC().Truncate(time.Second)}
+		if info != nil {
+			created.NewSize = sizeOf(info.Size)
+			created.ModifiedTime = info.ModifiedTime
+		}
+		deleted := created
+		deleted.Type = FileDeleted
+		deleted.OldSize, deleted.NewSize = created.NewSize, nil
+		changes.Events = append(changes.Events, created, deleted)
+	}
+	sort.SliceStable(changes.Events, func(i, j int) bool {
+		return changes.Events[i].Path < changes.Events[j].Path
+	})
+
+	for path := range prev.Entries {
+		delete(a.prev.Entries, path)
+	}
+	for path, e := range curr.Entries {
+		a.prev.Entries[path] = e
+	}
+	for dir := range a.dirs {
+		if within(dir, gone) {
+			delete(a.dirs, dir)
+			changes.RemovedDirectories = append(changes.RemovedDirectories, dir)
+		}
+	}
+	for dir := range present {
+		if !a.dirs[dir] {
+			a.dirs[dir] = true
+			changes.Directories = append(changes.Directories, dir)
+		}
+	}
+	changes.FileCount = len(a.prev.Entries)
+
+	if err := a.save(); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func (a *File) save() error {
+	if a.Store == nil {
+		return nil
+	}
+	return a.Store.Save(a.stateName(), a.prev)
+}
+
+func (a *File) stateName() string {
+	return "files/" + a.stateKey()
+}
+
+// stateKey identifies the state of the directory and the scan rules: a
+// snapshot taken with other rules would report everything they let through
+// differently as created or deleted.
+func (a *File) stateKey() string {
+	key, _ := json.Marshal(struct {
+		Path string
+		Scan Scan
+	}{a.MonitorDirectory, a.Scan})
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// diffSnapshots lists the changes from prev to curr, sorted by path.
+// Directories are only reported when created, deleted or renamed: their
+// mtime changes with their content, which is reported on its own.
+func diffSnapshots(prev, curr *snapshot) []Event {
+	events := []Event{}
+	var created, deleted []string
+	for path, c := range curr.Entries {
+		p, ok := prev.Entries[path]
+		if !ok {
+			created = append(created, path)
+			continue
+		}
+		if c.Dir || (p.Size == c.Size && p.MTime == c.MTime) {
+			continue
+		}
+		events = append(events, Event{
+			Type:         FileModified,
+			Path:         path,
+			OldSize:      sizeOf(p.Size),
+			NewSize:      sizeOf(c.Size),
+			ModifiedTime: time.Unix(c.MTime, 0).UTC(),
+		})
+	}
+	for path := range prev.Entries {
+		if _, ok := curr.Entries[path]; !ok {
+			deleted = append(deleted, path)
+		}
+	}
+	sort.Strings(created)
+	sort.Strings(deleted)
+
+	// Deleted entries are indexed by what a rename keeps, so matching takes
+	// a lookup per created entry rather than a pass over the deleted ones.
+	candidates := map[renameKey][]string{}
+	for _, oldPath := range deleted {
+		for _, key := range renameKeys(oldPath, prev.Entries[oldPath]) {
+			candidates[key] = append(candidates[key], oldPath)
+		}
+	}
+	renamed := map[string]bool{}
+	renamedFrom := map[string]string{}
+	for _, newPath := range created {
+		c := curr.Entries[newPath]
+		match := ""
+		for _, key := range renameKeys(newPath, c) {
+			for _, oldPath := range candidates[key] {
+				if renamed[oldPath] || !sameFile(oldPath, prev.Entries[oldPath], newPath, c) {
+					continue
+				}
+				// The first deleted path in order wins, as both lists are
+				// sorted.
+				if match == "" || oldPath < match {
+					match = oldPath
+				}
+				break
+			}
+		}
+		if match != "" {
+			renamedFrom[newPath] = match
+			renamed[match] = true
+		}
+	}
+
+	for _, path := range created {
+		c := curr.Entries[path]
+		event := Event{
+			Type:         FileCreated,
+			Path:         path,
+			NewSize:      sizeOf(c.Size),
+			ModifiedTime: time.Unix(c.MTime, 0).UTC(),
+		}
+		if oldPath, ok := renamedFrom[path]; ok {
+			event.Type = FileRenamed
+			event.OldPath = oldPath
+			event.OldSize = sizeOf(prev.Entries[oldPath].Size)
+		}
+		events = append(events, event)
+	}
+	for _, path := range deleted {
+		if renamed[path] {
+			continue
+		}
+		p := prev.Entries[path]
+		events = append(events, Event{
+			Type:         FileDeleted,
+			Path:         path,
+			OldSize:      sizeOf(p.Size),
+			ModifiedTime: time.Unix(p.MTime, 0).UTC(),
+		})
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Path < events[j].Path
+	})
+	return events
+}
+
+// renameKey is what a rename keeps of an entry: its kind, size and mtime,
+// and its inode or, for files, its name.
+type renameKey struct {
+	dir   bool
+	size  int64
+	mtime int64
+	inode uint64
+	base  string
+}
+
+// renameKeys returns the keys an entry can be matched by in a rename: its
+// inode where it has one, and its name unless it is a directory, for an
+// entry on the other side that has no inode. sameFile has the final say.
+func renameKeys(path string, e snapshotEntry) []renameKey {
+	var keys []renameKey
+	if e.Inode != 0 {
+		keys = append(keys, renameKey{dir: e.Dir, size: e.Size, mtime: e.MTime, inode: e.Inode})
+	}
+	if !e.Dir {
+		keys = append(keys, renameKey{size: e.Size, mtime: e.MTime, base: filepath.Base(path)})
+	}
+	return keys
+}
+
+func sameFile(oldPath string, old snapshotEntry, newPath string, curr snapshotEntry) bool {
+	if old.Dir != curr.Dir {
+		return false
+	}
+	if old.Size != curr.Size || old.MTime != curr.MTime {
+		return false
+	}
+	// A rename keeps the size and mtime. Comparing them too keeps a new
+	// file that reuses the inode of a deleted one from passing for a rename.
+	if old.Inode != 0 && curr.Inode != 0 {
+		return old.Inode == curr.Inode
+	}
+	return !old.Dir && filepath.Base(oldPath) == filepath.Base(newPath)
+}
+
+func sizeOf(size int64) *int64 {
+	return &size
+}
@@ -0,0 +1,144 @@
+package file
+
+import (
+	"daemon/internal/state"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	prev := &snapshot{Entries: map[string]snapshotEntry{
+		"/w/a.txt":       {Size: 10, MTime: 100, Inode: 1},
+		"/w/b.txt":       {Size: 20, MTime: 100, Inode: 2},
+		"/w/c.txt":       {Size: 30, MTime: 100, Inode: 3},
+		"/w/old/d.txt":   {Size: 40, MTime: 100},
+		"/w/docs":        {MTime: 100, Inode: 5, Dir: true},
+		"/w/reused.txt":  {Size: 50, MTime: 100, Inode: 6},
+		"/w/unchanged.c": {Size: 1, MTime: 100, Inode: 7},
+	}}
+	curr := &snapshot{Entries: map[string]snapshotEntry{
+		"/w/a.txt":       {Size: 11, MTime: 200, Inode: 1},
+		"/w/renamed.txt": {Size: 20, MTime: 100, Inode: 2},
+		"/w/new/d.txt":   {Size: 40, MTime: 100},
+		"/w/docs":        {MTime: 300, Inode: 5, Dir: true},
+		"/w/fresh.txt":   {Size: 50, MTime: 400, Inode: 6},
+		"/w/unchanged.c": {Size: 1, MTime: 100, Inode: 7},
+	}}
+
+	events := diffSnapshots(prev, curr)
+	summary := map[string]string{}
+	for _, e := range events {
+		summary[e.Path] = e.Type + " " + e.OldPath
+	}
+	assert.Equal(t, map[string]string{
+		"/w/a.txt":       "modified ",
+		"/w/renamed.txt": "renamed /w/b.txt",
+		"/w/new/d.txt":   "renamed /w/old/d.txt",
+		"/w/c.txt":       "deleted ",
+		"/w/fresh.txt":   "created ",
+		"/w/reused.txt":  "deleted ",
+	}, summary)
+
+	for _, e := range events {
+		switch e.Type {
+		case FileCreated:
+			assert.Nil(t, e.OldSize)
+			assert.Equal(t, int64(50), *e.NewSize)
+		case FileDeleted:
+			assert.NotNil(t, e.OldSize)
+			assert.Nil(t, e.NewSize)
+		case FileModified:
+			assert.Equal(t, int64(10), *e.OldSize)
+			assert.Equal(t, int64(11), *e.NewSize)
+		}
+	}
+}
+
+func TestFileChangesSurviveRestart(t *testing.T) {
+	root := t.TempDir()
+	store := &state.Store{Dir: t.TempDir()}
+	require.NoError(t, os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0644))
+
+	changes, err := (&File{MonitorDirectory: root, Native: true, Store: store}).GetFileChanges()
+	require.NoError(t, err)
+	assert.True(t, changes.Baseline)
+	assert.Empty(t, changes.Events)
+	assert.Len(t, changes.Files, 1)
+
+	require.NoError(t, os.Remove(filepath.Join(root, "a.txt")))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "b.txt"), []byte("bb"), 0644))
+
+	// A fresh File stands in for a restarted daemon.
+	changes, err = (&File{MonitorDirectory: root, Native: true, Store: store}).GetFileChanges()
+	require.NoError(t, err)
+	assert.False(t, changes.Baseline)
+	require.Len(t, changes.Events, 2)
+	assert.Equal(t, FileDeleted, changes.Events[0].Type)
+	assert.Equal(t, filepath.Join(root, "a.txt"), changes.Events[0].Path)
+	assert.Equal(t, FileCreated, changes.Events[1].Type)
+	assert.Equal(t, int64(2), *changes.Events[1].NewSize)
+
+	// Other scan rules start a new baseline instead of reporting the
+	// difference as changes.
+	changes, err = (&File{MonitorDirectory: root, Native: true, Store: store, Scan: Scan{MaxDepth: -1}}).GetFileChanges()
+	require.NoError(t, err)
+	assert.True(t, changes.Baseline)
+}
+
+func TestFileChangesKeepUnreadableDirectories(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no permission bits on Windows")
+	}
+	if os.Geteuid() == 0 {
+		t.Skip("root reads directories regardless of their permissions")
+	}
+	root := t.TempDir()
+	for _, name := range []string{"a/a.txt", "b/b.txt", "b/inner/c.txt"} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte("x"), 0644))
+	}
+
+	f := &File{MonitorDirectory: root, Native: true, Scan: Scan{MaxDepth: -1}}
+	_, err := f.GetFileChanges()
+	require.NoError(t, err)
+
+	// b is listed in one batch with a, which stays readable.
+	locked := filepath.Join(root, "b")
+	require.NoError(t, os.Chmod(locked, 0))
+	t.Cleanup(func() { os.Chmod(locked, 0755) })
+
+	changes, err := f.GetFileChanges()
+	require.NoError(t, err)
+	assert.Empty(t, changes.Events, "the contents of an unreadable directory are not deleted")
+}
+
+func TestDiffSnapshotsManyRenames(t *testing.T) {
+	// Every file moved to another directory, with the same size and mtime:
+	// only the inode tells them apart.
+	const n = 20000
+	prev := &snapshot{Entries: make(map[string]snapshotEntry, n)}
+	curr := &snapshot{Entries: make(map[string]snapshotEntry, n)}
+	for i := 0; i < n; i++ {
+		e := snapshotEntry{Size: 1, MTime: 100, Inode: uint64(i + 1)}
+		prev.Entries[fmt.Sprintf("/w/old/%d.txt", i)] = e
+		curr.Entries[fmt.Sprintf("/w/new/%d.txt", n-1-i)] = e
+	}
+
+	events := diffSnapshots(prev, curr)
+	require.Len(t, events, n)
+	for _, e := range events {
+		require.Equal(t, FileRenamed, e.Type)
+		var from, to int
+		_, err := fmt.Sscanf(e.OldPath, "/w/old/%d.txt", &from)
+		require.NoError(t, err)
+		_, err = fmt.Sscanf(e.Path, "/w/new/%d.txt", &to)
+		require.NoError(t, err)
+		require.Equal(t, n-1-from, to)
+	}
+}
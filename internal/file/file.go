@@ -1,12 +1,23 @@
 package file
 
 import (
+	"crypto/sha256"
+	"daemon/internal/osql"
+	"daemon/internal/state"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -14,63 +25,454 @@ import (
 )
 
 type FileInfo struct {
-	Path         string `json:"path"`
-	ModifiedTime string `json:"mtime"`
-	Size         int64  `json:"size"`
+	Path         string    `json:"path"`
+	ModifiedTime time.Time `json:"mtime"`
+	Size         int64     `json:"size"`
 }
 
 type File struct {
 	OsqueryInstance   *osquery.ExtensionManagerServer
 	OsquerySocketPath string
 	MonitorDirectory  string
+	Scan              Scan
 	Mutex             sync.Mutex
 	Logger            *log.Logger
+
+	// Native lists MonitorDirectory directly instead of querying osquery.
+	Native bool
+
+	// Store keeps the last listing for GetFileChanges across restarts.
+	Store *state.Store
+
+	// scanMutex guards the last listing, which a Watcher updates while
+	// the collector scans.
+	scanMutex sync.Mutex
+	prev      *snapshot
+	dirs      map[string]bool
+}
+
+// Scan controls which entries under MonitorDirectory are reported. Patterns
+// are matched against the path relative to MonitorDirectory, with forward
+// slashes on every platform.
+type Scan struct {
+	// MaxDepth is how many levels of subdirectories are scanned: 0, the
+	// default, lists the direct children of MonitorDirectory only, and -1
+	// has no limit.
+	MaxDepth int `mapstructure:"max_depth" validate:"min=-1"`
+	// Include, when set, limits the files reported to those matching one of
+	// the patterns. Directories are always descended into.
+	Include []string `mapstructure:"include"`
+	// Exclude drops matching files, and matching directories with
+	// everything below them.
+	Exclude []string `mapstructure:"exclude"`
+	// SkipHidden drops entries whose name starts with a dot.
+	SkipHidden bool `mapstructure:"skip_hidden"`
+	// SkipSymlinks drops symbolic links. Links are never followed either
+	// way.
+	SkipSymlinks bool `mapstructure:"skip_symlinks"`
+}
+
+// Watch is one monitored directory with its own scan rules and schedule.
+type Watch struct {
+	// Name identifies the entry in the stats. Defaults to the last element
+	// of Path.
+	Name string `mapstructure:"name"`
+	Path string `mapstructure:"path" validate:"required,dir"`
+	Scan `mapstructure:",squash"`
+	// Interval overrides the schedule of the files collector for this
+	// entry. In watch mode it is how often the changes seen are reported.
+	Interval time.Duration `mapstructure:"interval"`
+	// Mode is poll, the default, which scans on every run of the
+	// collector, or watch, which picks up changes as they happen.
+	Mode string `mapstructure:"mode" validate:"omitempty,oneof=poll watch"`
+	// Debounce and Reconcile tune watch mode, see Watcher.
+	Debounce  time.Duration `mapstructure:"debounce"`
+	Reconcile time.Duration `mapstructure:"reconcile"`
+	// Integrity also checks the files against a baseline of their hashes,
+	// see Integrity.
+	Integrity bool `mapstructure:"integrity"`
+	// Labels are copied to the stats of the entry, e.g. to tell a network
+	// share from a local directory.
+	Labels map[string]string `mapstructure:"labels"`
+}
+
+// Validate checks the glob patterns.
+func (s Scan) Validate() error {
+	if err := validateGlobs(s.Include); err != nil {
+		return err
+	}
+	return validateGlobs(s.Exclude)
+}
+
+// entry is a directory entry as listed by either backend.
+type entry struct {
+	FileInfo
+	dir     bool
+	symlink bool
+	// inode is 0 where the platform has none, and is only used to detect
+	// renames.
+	inode uint64
+	// mode and owner are only used for integrity checks, see Fingerprint.
+	mode  string
+	owner string
+}
+
+// directoryBatch bounds how many directories one osquery query lists, so a
+// wide tree takes several moderate queries instead of one huge one.
+const directoryBatch = 100
+
+func (a *File) GetFileModificationStats() ([]FileInfo, error) {
+	entries, _, _, err := a.list()
+	if err != nil {
+		return nil, err
+	}
+	files := make([]FileInfo, 0, len(entries))
+	for _, e := range entries {
+		files = append(files, e.FileInfo)
+	}
+	return files, nil
 }
 
-func (a *File) GetFileModificationStats() (string, error) {
+// lister lists the direct children of a batch of directories. It returns
+// the directories of the batch that could not be read alongside the entries
+// of the others, and an error when the batch as a whole failed.
+type lister func(dirs []string) (entries []entry, failed []string, err error)
+
+// hasher returns the SHA-256 of each of a batch of files, leaving out the
+// ones that could not be read.
+type hasher func(paths []string) (map[string]string, error)
+
+// backend is how the files are read: through osquery or natively.
+type backend struct {
+	list lister
+	hash hasher
+}
+
+// withBackend calls fn with the configured backend.
+func (a *File) withBackend(fn func(b backend) error) error {
+	if a.Native {
+		return fn(backend{list: nativeList, hash: nativeHash})
+	}
 	if a.OsqueryInstance == nil {
-		return "", fmt.Errorf("osquery instance not initialized")
+		return fmt.Errorf("osquery instance not initialized")
 	}
 
 	client, err := osquery.NewClient(a.OsquerySocketPath, 10*time.Second)
 	if err != nil {
-		return "", fmt.Errorf("failed to create osquery client: %w", err)
+		return fmt.Errorf("failed to create osquery client: %w", err)
 	}
 	defer client.Close()
 
-	query := fmt.Sprintf("SELECT path, mtime, size FROM file WHERE directory = '%s' ORDER BY mtime DESC", a.MonitorDirectory)
+	return fn(backend{
+		list: func(dirs []string) ([]entry, []string, error) {
+			return osqueryList(client, dirs)
+		},
+		hash: func(paths []string) (map[string]string, error) {
+			return osqueryHash(client, paths)
+		},
+	})
+}
+
+// list returns the entries of MonitorDirectory that pass the Scan filters,
+// newest first, the directories scanned below it and those that could not
+// be listed.
+func (a *File) list() (entries []entry, dirs, unlisted []string, err error) {
+	err = a.withBackend(func(b backend) error {
+		entries, dirs, unlisted, err = a.walk(b.list, []string{a.MonitorDirectory}, 0, nil)
+		return err
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	log.Println("Updated files stats")
+	return entries, dirs, unlisted, nil
+}
+
+// walk lists the directories in level, which are depth levels below
+// MonitorDirectory, one level at a time. It descends into the subdirectories
+// the Scan rules allow, and of those only into the ones follow returns true
+// for, when set. It returns the entries that pass the Scan filters, newest
+// first, every subdirectory the rules allow, followed or not, and the
+// subdirectories that could not be listed.
+func (a *File) walk(list lister, level []string, depth int, follow func(dir string) bool) (files []entry, dirs, unlisted []string, err error) {
+	files = []entry{}
+	dirs = []string{}
+	for first := true; len(level) > 0; depth++ {
+		var next []string
+		for start := 0; start < len(level); start += directoryBatch {
+			batch := level[start:min(start+directoryBatch, len(level))]
+			entries, failed, err := list(batch)
+			if err == nil && first && len(failed) > 0 {
+				err = fmt.Errorf("failed to read directory %s", failed[0])
+			}
+			if err != nil {
+				if first {
+					return nil, nil, nil, err
+				}
+				// A subdirectory that cannot be read should not hide the
+				// rest of the tree. Unless it vanished, its contents are
+				// unknown rather than gone.
+				if !errors.Is(err, fs.ErrNotExist) {
+					unlisted = append(unlisted, batch...)
+				}
+				continue
+			}
+			unlisted = append(unlisted, failed...)
+
+			for _, e := range entries {
+				report, descend := a.filter(e, depth)
+				if descend {
+					dirs = append(dirs, e.Path)
+					if follow == nil || follow(e.Path) {
+						next = append(next, e.Path)
+					}
+				}
+				if report {
+					files = append(files, e)
+				}
+			}
+		}
+		level = next
+		first = false
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].ModifiedTime.After(files[j].ModifiedTime)
+	})
+	return files, dirs, unlisted, nil
+}
+
+// within reports whether path is one of dirs or below one of them.
+func within(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// filter applies the Scan rules to an entry found depth levels below
+// MonitorDirectory: whether to report it and whether to descend into it.
+func (a *File) filter(e entry, depth int) (report, descend bool) {
+	rel, err := filepath.Rel(a.MonitorDirectory, e.Path)
+	if err != nil {
+		return false, false
+	}
+	rel = filepath.ToSlash(rel)
+	if a.Scan.SkipHidden && strings.HasPrefix(path.Base(rel), ".") {
+		return false, false
+	}
+	if a.Scan.SkipSymlinks && e.symlink {
+		return false, false
+	}
+	if matchAny(a.Scan.Exclude, rel) {
+		return false, false
+	}
+	descend = e.dir && !e.symlink && (a.Scan.MaxDepth < 0 || depth < a.Scan.MaxDepth)
+	report = len(a.Scan.Include) == 0 || (!e.dir && matchAny(a.Scan.Include, rel))
+	return report, descend
+}
+
+// depthOf returns how many levels below MonitorDirectory the children of
+// dir are, or -1 when dir is outside it.
+func (a *File) depthOf(dir string) int {
+	rel, err := filepath.Rel(a.MonitorDirectory, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return -1
+	}
+	if rel == "." {
+		return 0
+	}
+	return len(strings.Split(filepath.ToSlash(rel), "/"))
+}
+
+func osqueryRows(client *osquery.ExtensionManagerClient, query string) ([]map[string]string, error) {
 	response, err := client.Query(query)
 	if err != nil {
-		return "", fmt.Errorf("failed to execute osquery query: %w", err)
+		return nil, fmt.Errorf("failed to execute osquery query: %w", err)
+	}
+	if status := response.GetStatus(); status != nil && status.Code != 0 {
+		return nil, fmt.Errorf("osquery query failed: %s", status.Message)
 	}
+	return response.Response, nil
+}
 
-	var files []FileInfo
+// osqueryList lists dirs through the osquery file table. It returns no rows
+// for a directory it cannot read, so the directories without rows are
+// checked natively: those that are empty or gone are not failures.
+func osqueryList(client *osquery.ExtensionManagerClient, dirs []string) ([]entry, []string, error) {
+	query, err := osql.Build("SELECT path, mtime, size, type, symlink, inode, mode, uid, gid, directory FROM file WHERE directory IN (?)", dirs)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := osqueryRows(client, query)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	for _, r := range response.Response {
+	listed := map[string]bool{}
+	for _, r := range rows {
+		listed[strings.TrimRight(r["directory"], `/\`)] = true
+	}
+	var failed []string
+	for _, dir := range dirs {
+		if !listed[strings.TrimRight(dir, `/\`)] && !emptyOrGone(dir) {
+			failed = append(failed, dir)
+		}
+	}
+
+	entries := []entry{}
+	for _, r := range rows {
 		mtimeUnix, err := strconv.ParseInt(r["mtime"], 10, 64)
 		if err != nil {
 			fmt.Println("Failed to parse mtime: ", err)
 			continue
 		}
-		mtime := time.Unix(mtimeUnix, 0).Format(time.RFC3339)
 		size, err := strconv.ParseInt(r["size"], 10, 64)
 		if err != nil {
 			fmt.Println("Failed to parse size: ", err)
 			continue
 		}
-		files = append(files, FileInfo{
-			Path:         r["path"],
-			ModifiedTime: mtime,
-			Size:         size,
+		entries = append(entries, entry{
+			FileInfo: FileInfo{
+				// Directories may be listed with a trailing separator.
+				Path:         strings.TrimRight(r["path"], `/\`),
+				ModifiedTime: time.Unix(mtimeUnix, 0).UTC(),
+				Size:         size,
+			},
+			dir:     r["type"] == "directory",
+			symlink: r["symlink"] == "1",
+			inode:   parseInode(r["inode"]),
+			mode:    r["mode"],
+			owner:   osqueryOwner(r["uid"], r["gid"]),
 		})
 	}
-	jsonData, err := json.MarshalIndent(files, "", "  ")
+	return entries, failed, nil
+}
+
+// emptyOrGone reports whether dir is known to have no children. A
+// directory the daemon cannot read either is not.
+func emptyOrGone(dir string) bool {
+	children, err := os.ReadDir(dir)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal file info to JSON: %w", err)
+		return errors.Is(err, fs.ErrNotExist)
 	}
+	return len(children) == 0
+}
 
-	log.Println("Updated files stats")
-	return string(jsonData), nil
+// osqueryOwner formats the owner like ownerOf. Windows has no uid or gid.
+func osqueryOwner(uid, gid string) string {
+	if runtime.GOOS == "windows" || uid == "" {
+		return ""
+	}
+	return uid + ":" + gid
+}
+
+func osqueryHash(client *osquery.ExtensionManagerClient, paths []string) (map[string]string, error) {
+	query, err := osql.Build("SELECT path, sha256 FROM hash WHERE path IN (?)", paths)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := osqueryRows(client, query)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]string, len(rows))
+	for _, r := range rows {
+		if r["sha256"] != "" {
+			hashes[r["path"]] = r["sha256"]
+		}
+	}
+	return hashes, nil
+}
+
+func parseInode(s string) uint64 {
+	inode, _ := strconv.ParseUint(s, 10, 64)
+	return inode
+}
+
+// nativeList lists the same entries as the osquery file table, with mtime
+// in whole seconds.
+func nativeList(dirs []string) ([]entry, []string, error) {
+	entries := []entry{}
+	var failed []string
+	for _, dir := range dirs {
+		children, err := os.ReadDir(dir)
+		if err != nil {
+			// A lone directory fails the call, so that walk can tell a
+			// root that vanished from one that cannot be read.
+			if len(dirs) == 1 {
+				return nil, nil, fmt.Errorf("failed to read directory: %w", err)
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				failed = append(failed, dir)
+			}
+			continue
+		}
+		for _, child := range children {
+			info, err := child.Info()
+			if err != nil {
+				// Removed since the directory was read.
+				continue
+			}
+			entries = append(entries, entry{
+				FileInfo: FileInfo{
+					Path:         filepath.Join(dir, child.Name()),
+					ModifiedTime: info.ModTime().Truncate(time.Second).UTC(),
+					Size:         info.Size(),
+				},
+				dir:     child.IsDir(),
+				symlink: child.Type()&os.ModeSymlink != 0,
+				inode:   inodeOf(info),
+				mode:    modeString(info.Mode()),
+				owner:   ownerOf(info),
+			})
+		}
+	}
+	return entries, failed, nil
+}
+
+// modeString formats the permission bits in octal like the osquery file
+// table, e.g. 0644 or 4755 with setuid.
+func modeString(mode os.FileMode) string {
+	bits := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 01000
+	}
+	return fmt.Sprintf("%04o", bits)
+}
+
+func nativeHash(paths []string) (map[string]string, error) {
+	hashes := make(map[string]string, len(paths))
+	for _, path := range paths {
+		sum, err := hashFile(path)
+		if err != nil {
+			// Unreadable, or removed since it was listed.
+			continue
+		}
+		hashes[path] = sum
+	}
+	return hashes, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
 func (a *File) GetLatestFileModifications() string {
@@ -78,10 +480,15 @@ func (a *File) GetLatestFileModifications() string {
 	if err != nil {
 		return fmt.Sprintf("Error getting file modification stats: %v", err)
 	}
-	return stats
+	jsonData, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("Error marshalling file modification stats: %v", err)
+	}
+	return string(jsonData)
 }
 
-func (a *File) SaveStatsToFile(fileStats string, systemStats string) error {
+// SaveStatsToFile appends record to the stats log as a single JSON line.
+func (a *File) SaveStatsToFile(record interface{}) error {
 	a.Mutex.Lock()
 	defer a.Mutex.Unlock()
 	homeDir, err := os.UserHomeDir()
@@ -99,7 +506,11 @@ func (a *File) SaveStatsToFile(fileStats string, systemStats string) error {
 	}
 	defer file.Close()
 
-	_, err = file.WriteString(fmt.Sprintf("File Stats: %s\nSystem Stats: %s\n", fileStats, systemStats))
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal stats record: %w", err)
+	}
+	_, err = file.Write(append(line, '\n'))
 	if err != nil {
 		return fmt.Errorf("failed to write stats to file: %w", err)
 	}
@@ -0,0 +1,109 @@
+package file
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNativeScan(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{
+		"report.docx",
+		"notes.txt",
+		".hidden.docx",
+		"a/b/deep.docx",
+		"a/node_modules/pkg/index.docx",
+		".git/config.docx",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte("x"), 0644))
+	}
+	if err := os.Symlink(filepath.Join(root, "a"), filepath.Join(root, "link.docx")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	scan := func(s Scan) []string {
+		f := &File{MonitorDirectory: root, Scan: s, Native: true}
+		files, err := f.GetFileModificationStats()
+		require.NoError(t, err)
+		names := []string{}
+		for _, file := range files {
+			rel, err := filepath.Rel(root, file.Path)
+			require.NoError(t, err)
+			names = append(names, filepath.ToSlash(rel))
+		}
+		return names
+	}
+
+	// The defaults list the direct children, as before.
+	assert.ElementsMatch(t, []string{"report.docx", "notes.txt", ".hidden.docx", "a", ".git", "link.docx"}, scan(Scan{}))
+
+	assert.ElementsMatch(t, []string{"report.docx", ".hidden.docx", "a/b/deep.docx", "link.docx"}, scan(Scan{
+		MaxDepth: -1,
+		Include:  []string{"**/*.docx"},
+		Exclude:  []string{"**/node_modules/**", ".git"},
+	}))
+
+	assert.ElementsMatch(t, []string{"report.docx"}, scan(Scan{
+		MaxDepth:     1,
+		Include:      []string{"*.docx"},
+		SkipHidden:   true,
+		SkipSymlinks: true,
+	}))
+}
+
+func TestWalkReportsUnlistedDirectories(t *testing.T) {
+	root := filepath.FromSlash("/w")
+	walk := func(child string, err error) []string {
+		list := func(dirs []string) ([]entry, []string, error) {
+			if dirs[0] != root {
+				return nil, nil, err
+			}
+			return []entry{
+				{FileInfo: FileInfo{Path: filepath.Join(root, child)}, dir: true},
+				{FileInfo: FileInfo{Path: filepath.Join(root, "a.txt")}},
+			}, nil, nil
+		}
+		f := &File{MonitorDirectory: root, Scan: Scan{MaxDepth: -1}}
+		entries, _, unlisted, walkErr := f.walk(list, []string{root}, 0, nil)
+		require.NoError(t, walkErr)
+		assert.Len(t, entries, 2)
+		return unlisted
+	}
+
+	// A directory that failed to list is unknown, one that vanished is gone.
+	unlisted := walk("broken", errors.New("query failed"))
+	assert.Equal(t, []string{filepath.Join(root, "broken")}, unlisted)
+	assert.Empty(t, walk("gone", fs.ErrNotExist))
+
+	// So is one that failed within a batch of several.
+	list := func(dirs []string) ([]entry, []string, error) {
+		if dirs[0] != root {
+			return []entry{{FileInfo: FileInfo{Path: filepath.Join(root, "ok", "b.txt")}}}, []string{filepath.Join(root, "locked")}, nil
+		}
+		return []entry{
+			{FileInfo: FileInfo{Path: filepath.Join(root, "ok")}, dir: true},
+			{FileInfo: FileInfo{Path: filepath.Join(root, "locked")}, dir: true},
+		}, nil, nil
+	}
+	f := &File{MonitorDirectory: root, Scan: Scan{MaxDepth: -1}}
+	entries, _, batchUnlisted, err := f.walk(list, []string{root}, 0, nil)
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, []string{filepath.Join(root, "locked")}, batchUnlisted)
+
+	// The root itself failing fails the walk.
+	_, _, _, err = f.walk(func(dirs []string) ([]entry, []string, error) { return nil, dirs, nil }, []string{root}, 0, nil)
+	assert.Error(t, err)
+
+	assert.True(t, within(filepath.Join(root, "broken"), unlisted))
+	assert.True(t, within(filepath.Join(root, "broken", "x.txt"), unlisted))
+	assert.False(t, within(filepath.Join(root, "broken2", "x.txt"), unlisted))
+}
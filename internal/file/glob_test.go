@@ -0,0 +1,34 @@
+package file
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchGlob(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, name string
+		match         bool
+	}{
+		{"**/*.docx", "report.docx", true},
+		{"**/*.docx", "a/b/report.docx", true},
+		{"*.docx", "a/b/report.docx", true},
+		{"*.docx", "a/report.txt", false},
+		{"docs/*.md", "docs/readme.md", true},
+		{"docs/*.md", "docs/sub/readme.md", false},
+		{"docs/**/*.md", "docs/sub/deeper/readme.md", true},
+		{"**/node_modules/**", "node_modules", true},
+		{"**/node_modules/**", "web/node_modules/react/index.js", true},
+		{"**/node_modules/**", "web/node_modules_old/index.js", false},
+		{"build", "build", true},
+		{"build", "src/build", true},
+	} {
+		assert.Equal(t, tc.match, matchGlob(tc.pattern, tc.name), "%s against %s", tc.pattern, tc.name)
+	}
+}
+
+func TestValidateGlobs(t *testing.T) {
+	assert.NoError(t, validateGlobs([]string{"**/*.docx", "a/[bc]/*"}))
+	assert.Error(t, validateGlobs([]string{"a/[b"}))
+}
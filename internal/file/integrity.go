@@ -0,0 +1,275 @@
+package file
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// ViolationContent is a file whose hash or size differs from the
+	// baseline, whatever its mtime says.
+	ViolationContent     = "content"
+	ViolationPermissions = "permissions"
+	ViolationOwner       = "owner"
+	ViolationAdded       = "added"
+	ViolationRemoved     = "removed"
+)
+
+// Fingerprint is what the integrity baseline records of a file.
+type Fingerprint struct {
+	// SHA256 is empty when the file could not be read.
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	// Mode is the permission bits in octal, e.g. 0644 or 4755 with setuid.
+	Mode string `json:"mode"`
+	// Owner is uid:gid, and empty on Windows, where it is not compared.
+	Owner string `json:"owner,omitempty"`
+}
+
+// Violation is a file that no longer matches the baseline. A file can have
+// several, e.g. one for its content and one for its permissions.
+type Violation struct {
+	Type string `json:"type"`
+	Path string `json:"path"`
+	// Expected is null for added files and Actual for removed ones.
+	Expected *Fingerprint `json:"expected"`
+	Actual   *Fingerprint `json:"actual"`
+}
+
+// IntegrityReport is the outcome of one integrity check.
+type IntegrityReport struct {
+	Time      time.Time `json:"time"`
+	FileCount int       `json:"file_count"`
+	// Baseline is true when the check recorded a new baseline, so
+	// Violations is empty.
+	Baseline   bool        `json:"baseline"`
+	Violations []Violation `json:"violations"`
+}
+
+// Integrity checks the regular files of File against a baseline of their
+// SHA-256, size, mode and owner. Unlike the changes reported by
+// GetFileChanges, a violation is reported by every check until it is
+// accepted into the baseline.
+type Integrity struct {
+	File *File
+
+	mutex    sync.Mutex
+	baseline map[string]Fingerprint
+	current  map[string]Fingerprint
+	last     *IntegrityReport
+}
+
+// Check fingerprints the files and compares them with the baseline. The
+// first check records the baseline, which is kept in the Store of File,
+// when set.
+func (i *Integrity) Check() (*IntegrityReport, error) {
+	current, unlisted, err := i.File.fingerprints()
+	if err != nil {
+		return nil, err
+	}
+
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if i.baseline == nil && i.File.Store != nil {
+		var saved map[string]Fingerprint
+		found, err := i.File.Store.Load(i.stateName(), &saved)
+		if err != nil {
+			return nil, err
+		}
+		if found && saved != nil {
+			i.baseline = saved
+		}
+	}
+
+	report := &IntegrityReport{
+		Time:       time.Now().UTC().Truncate(time.Second),
+		FileCount:  len(current),
+		Violations: []Violation{},
+	}
+	// Files below a directory that could not be listed are taken to be as
+	// the baseline has them, rather than removed.
+	for path, f := range i.baseline {
+		if _, ok := current[path]; !ok && within(path, unlisted) {
+			current[path] = f
+		}
+	}
+	if i.baseline == nil {
+		report.Baseline = true
+		i.baseline = copyFingerprints(current)
+		if err := i.save(); err != nil {
+			return nil, err
+		}
+	} else {
+		report.Violations = compareFingerprints(i.baseline, current)
+	}
+	i.current = current
+	i.last = report
+	return report, nil
+}
+
+// Last returns the report of the latest check, or nil before the first.
+func (i *Integrity) Last() *IntegrityReport {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.last
+}
+
+// Accept takes the state the latest check found of paths into the
+// baseline, or of every file when paths is empty, so that their violations
+// are no longer reported.
+func (i *Integrity) Accept(paths []string) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if i.current == nil {
+		return fmt.Errorf("no integrity check to accept yet")
+	}
+	if len(paths) == 0 {
+		i.baseline = copyFingerprints(i.current)
+	} else {
+		for _, path := range paths {
+			if f, ok := i.current[path]; ok {
+				i.baseline[path] = f
+			} else {
+				delete(i.baseline, path)
+			}
+		}
+	}
+	if err := i.save(); err != nil {
+		return err
+	}
+
+	last := *i.last
+	last.Violations = compareFingerprints(i.baseline, i.current)
+	i.last = &last
+	return nil
+}
+
+// Reset forgets the baseline. The next check records a new one.
+func (i *Integrity) Reset() error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.baseline = nil
+	i.current = nil
+	i.last = nil
+	if i.File.Store == nil {
+		return nil
+	}
+	return i.File.Store.Delete(i.stateName())
+}
+
+func (i *Integrity) save() error {
+	if i.File.Store == nil {
+		return nil
+	}
+	return i.File.Store.Save(i.stateName(), i.baseline)
+}
+
+// stateName follows the scan rules like the snapshot of GetFileChanges: a
+// baseline taken with other rules would report the files they let through
+// differently as added or removed.
+func (i *Integrity) stateName() string {
+	return "integrity/" + i.File.stateKey()
+}
+
+// fingerprints lists the regular files that pass the Scan filters and
+// fingerprints them. Directories and symbolic links are left out. It also
+// returns the directories that could not be listed.
+func (a *File) fingerprints() (map[string]Fingerprint, []string, error) {
+	fingerprints := map[string]Fingerprint{}
+	var unlisted []string
+	err := a.withBackend(func(b backend) error {
+		entries, _, skipped, err := a.walk(b.list, []string{a.MonitorDirectory}, 0, nil)
+		if err != nil {
+			return err
+		}
+		unlisted = skipped
+
+		paths := make([]string, 0, len(entries))
+		for _, e := range entries {
+			if e.dir || e.symlink {
+				continue
+			}
+			paths = append(paths, e.Path)
+			fingerprints[e.Path] = Fingerprint{Size: e.Size, Mode: e.mode, Owner: e.owner}
+		}
+		for start := 0; start < len(paths); start += directoryBatch {
+			hashes, err := b.hash(paths[start:min(start+directoryBatch, len(paths))])
+			if err != nil {
+				return err
+			}
+			for path, sum := range hashes {
+				if f, ok := fingerprints[path]; ok {
+					f.SHA256 = sum
+					fingerprints[path] = f
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return fingerprints, unlisted, nil
+}
+
+// compareFingerprints lists the violations of curr against baseline, sorted
+// by path.
+func compareFingerprints(baseline, curr map[string]Fingerprint) []Violation {
+	paths := make([]string, 0, len(curr))
+	for path := range curr {
+		paths = append(paths, path)
+	}
+	for path := range baseline {
+		if _, ok := curr[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	violations := []Violation{}
+	for _, path := range paths {
+		expected, known := baseline[path]
+		actual, present := curr[path]
+		violation := func(kind string) Violation {
+			v := Violation{Type: kind, Path: path}
+			if known {
+				v.Expected = &expected
+			}
+			if present {
+				v.Actual = &actual
+			}
+			return v
+		}
+
+		switch {
+		case !known:
+			violations = append(violations, violation(ViolationAdded))
+		case !present:
+			violations = append(violations, violation(ViolationRemoved))
+		default:
+			if expected.SHA256 != actual.SHA256 || expected.Size != actual.Size {
+				violations = append(violations, violation(ViolationContent))
+			}
+			if expected.Mode != actual.Mode {
+				violations = append(violations, violation(ViolationPermissions))
+			}
+			if expected.Owner != actual.Owner {
+				violations = append(violations, violation(ViolationOwner))
+			}
+		}
+	}
+	return violations
+}
+
+func copyFingerprints(fingerprints map[string]Fingerprint) map[string]Fingerprint {
+	c := make(map[string]Fingerprint, len(fingerprints))
+	for path, f := range fingerprints {
+		c[path] = f
+	}
+	return c
+}
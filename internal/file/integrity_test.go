@@ -0,0 +1,122 @@
+package file
+
+import (
+	"daemon/internal/state"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareFingerprints(t *testing.T) {
+	baseline := map[string]Fingerprint{
+		"/w/a": {SHA256: "aa", Size: 1, Mode: "0644", Owner: "0:0"},
+		"/w/b": {SHA256: "bb", Size: 1, Mode: "0644", Owner: "0:0"},
+		"/w/c": {SHA256: "cc", Size: 1, Mode: "0644", Owner: "0:0"},
+		"/w/d": {SHA256: "dd", Size: 1, Mode: "0644", Owner: "0:0"},
+	}
+	curr := map[string]Fingerprint{
+		"/w/a": {SHA256: "aa", Size: 1, Mode: "0644", Owner: "0:0"},
+		"/w/b": {SHA256: "b2", Size: 1, Mode: "4755", Owner: "0:0"},
+		"/w/c": {SHA256: "cc", Size: 1, Mode: "0644", Owner: "501:20"},
+		"/w/e": {SHA256: "ee", Size: 1, Mode: "0644", Owner: "0:0"},
+	}
+
+	violations := compareFingerprints(baseline, curr)
+	var summary []string
+	for _, v := range violations {
+		summary = append(summary, v.Path+" "+v.Type)
+	}
+	assert.Equal(t, []string{
+		"/w/b content",
+		"/w/b permissions",
+		"/w/c owner",
+		"/w/d removed",
+		"/w/e added",
+	}, summary)
+
+	assert.Equal(t, "bb", violations[0].Expected.SHA256)
+	assert.Equal(t, "b2", violations[0].Actual.SHA256)
+	assert.Nil(t, violations[3].Actual)
+	assert.Nil(t, violations[4].Expected)
+}
+
+func TestIntegrityDetectsContentChangeWithoutMtime(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "passwd")
+	require.NoError(t, os.WriteFile(path, []byte("root:x:0:0"), 0644))
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.NoError(t, os.Chtimes(path, mtime, mtime))
+
+	store := &state.Store{Dir: t.TempDir()}
+	integrity := &Integrity{File: &File{MonitorDirectory: root, Native: true, Store: store}}
+	report, err := integrity.Check()
+	require.NoError(t, err)
+	assert.True(t, report.Baseline)
+	assert.Equal(t, 1, report.FileCount)
+	assert.Empty(t, report.Violations)
+
+	// Same size and mtime, other content.
+	require.NoError(t, os.WriteFile(path, []byte("toor:x:0:0"), 0644))
+	require.NoError(t, os.Chtimes(path, mtime, mtime))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "added"), nil, 0644))
+
+	// A new instance picks the baseline up from the store.
+	integrity = &Integrity{File: &File{MonitorDirectory: root, Native: true, Store: store}}
+	report, err = integrity.Check()
+	require.NoError(t, err)
+	assert.False(t, report.Baseline)
+	require.Len(t, report.Violations, 2)
+	assert.Equal(t, ViolationAdded, report.Violations[0].Type)
+	assert.Equal(t, ViolationContent, report.Violations[1].Type)
+	assert.Equal(t, path, report.Violations[1].Path)
+
+	// Violations are reported until accepted.
+	report, err = integrity.Check()
+	require.NoError(t, err)
+	assert.Len(t, report.Violations, 2)
+
+	require.NoError(t, integrity.Accept([]string{path}))
+	require.Len(t, integrity.Last().Violations, 1)
+	assert.Equal(t, ViolationAdded, integrity.Last().Violations[0].Type)
+	report, err = integrity.Check()
+	require.NoError(t, err)
+	assert.Len(t, report.Violations, 1)
+
+	require.NoError(t, integrity.Accept(nil))
+	report, err = integrity.Check()
+	require.NoError(t, err)
+	assert.Empty(t, report.Violations)
+}
+
+func TestIntegrityPermissionsAndReset(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no permission bits on Windows")
+	}
+	root := t.TempDir()
+	path := filepath.Join(root, "script.sh")
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh"), 0644))
+
+	integrity := &Integrity{File: &File{MonitorDirectory: root, Native: true}}
+	_, err := integrity.Check()
+	require.NoError(t, err)
+
+	require.NoError(t, os.Chmod(path, 0755))
+	report, err := integrity.Check()
+	require.NoError(t, err)
+	require.Len(t, report.Violations, 1)
+	assert.Equal(t, ViolationPermissions, report.Violations[0].Type)
+	assert.Equal(t, "0644", report.Violations[0].Expected.Mode)
+	assert.Equal(t, "0755", report.Violations[0].Actual.Mode)
+
+	require.NoError(t, integrity.Reset())
+	assert.Nil(t, integrity.Last())
+	assert.Error(t, integrity.Accept(nil))
+	report, err = integrity.Check()
+	require.NoError(t, err)
+	assert.True(t, report.Baseline)
+}
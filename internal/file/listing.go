@@ -0,0 +1,248 @@
+package file
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// ListedFile is a monitored file as returned by ListFiles.
+type ListedFile struct {
+	Watch string `json:"watch"`
+	FileInfo
+}
+
+// WatchListing is the latest listing of one watch entry.
+type WatchListing struct {
+	Watch string
+	Root  string
+	Files []FileInfo
+}
+
+// ListOptions filters, sorts and pages ListFiles.
+type ListOptions struct {
+	// Watch keeps the files of the named watch entry, when set.
+	Watch string
+	// ModifiedSince keeps the files modified at or after it, when set.
+	ModifiedSince time.Time
+	// MinSize and MaxSize bound the size in bytes, when set.
+	MinSize *int64
+	MaxSize *int64
+	// Glob keeps the files matching the pattern, relative to the root of
+	// their watch entry, with the same syntax as Scan.Include.
+	Glob string
+	// Sort is mtime, size or path, with a leading - for descending. The
+	// default is -mtime, newest first.
+	Sort string
+	// Limit is the page size, 100 by default and at most 1000.
+	Limit int
+	// Cursor is the NextCursor of the previous page.
+	Cursor string
+}
+
+// Page is one page of ListFiles.
+type Page struct {
+	Files []ListedFile `json:"files"`
+	// NextCursor fetches the next page, and is empty on the last.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// cursor is the last file of a page, so the next page starts after it even
+// when files were added or removed in between. Filters is a hash of the
+// filters of the page: a cursor only makes sense with the same ones.
+type cursor struct {
+	Sort    string    `json:"sort"`
+	Filters string    `json:"filters"`
+	Watch   string    `json:"watch"`
+	Path    string    `json:"path"`
+	MTime   time.Time `json:"mtime"`
+	Size    int64     `json:"size"`
+}
+
+// Listing returns the files of the latest scan, directories left out, or
+// false before the first scan.
+func (a *File) Listing() ([]FileInfo, bool) {
+	a.scanMutex.Lock()
+	defer a.scanMutex.Unlock()
+	if a.prev == nil {
+		return nil, false
+	}
+	files := make([]FileInfo, 0, len(a.prev.Entries))
+	for path, e := range a.prev.Entries {
+		if e.Dir {
+			continue
+		}
+		files = append(files, FileInfo{
+			Path:         path,
+			ModifiedTime: time.Unix(e.MTime, 0).UTC(),
+			Size:         e.Size,
+		})
+	}
+	return files, true
+}
+
+// ListFiles filters, sorts and pages the files of listings.
+func ListFiles(listings []WatchListing, opts ListOptions) (*Page, error) {
+	sortBy := opts.Sort
+	if sortBy == "" {
+		sortBy = "-mtime"
+	}
+	less, err := fileOrder(sortBy)
+	if err != nil {
+		return nil, err
+	}
+	limit := opts.Limit
+	if limit < 0 {
+		return nil, fmt.Errorf("limit must not be negative")
+	}
+	if limit == 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		return nil, fmt.Errorf("limit must be at most %d", maxListLimit)
+	}
+	if opts.Glob != "" {
+		if err := validateGlobs([]string{opts.Glob}); err != nil {
+			return nil, err
+		}
+	}
+
+	var after *ListedFile
+	if opts.Cursor != "" {
+		c, err := decodeCursor(opts.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if c.Sort != sortBy {
+			return nil, fmt.Errorf("cursor was issued for sort %s", c.Sort)
+		}
+		if c.Filters != filterHash(opts) {
+			return nil, fmt.Errorf("cursor was issued for other filters")
+		}
+		after = &ListedFile{Watch: c.Watch, FileInfo: FileInfo{Path: c.Path, ModifiedTime: c.MTime, Size: c.Size}}
+	}
+
+	files := []ListedFile{}
+	for _, l := range listings {
+		if opts.Watch != "" && l.Watch != opts.Watch {
+			continue
+		}
+		for _, f := range l.Files {
+			if !opts.ModifiedSince.IsZero() && f.ModifiedTime.Before(opts.ModifiedSince) {
+				continue
+			}
+			if opts.MinSize != nil && f.Size < *opts.MinSize {
+				continue
+			}
+			if opts.MaxSize != nil && f.Size > *opts.MaxSize {
+				continue
+			}
+			if opts.Glob != "" {
+				rel, err := filepath.Rel(l.Root, f.Path)
+				if err != nil || !matchGlob(opts.Glob, filepath.ToSlash(rel)) {
+					continue
+				}
+			}
+			listed := ListedFile{Watch: l.Watch, FileInfo: f}
+			if after != nil && !less(*after, listed) {
+				continue
+			}
+			files = append(files, listed)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return less(files[i], files[j])
+	})
+
+	page := &Page{Files: files}
+	if len(files) > limit {
+		page.Files = files[:limit]
+		last := page.Files[limit-1]
+		page.NextCursor = encodeCursor(cursor{
+			Sort:    sortBy,
+			Filters: filterHash(opts),
+			Watch:   last.Watch,
+			Path:    last.Path,
+			MTime:   last.ModifiedTime,
+			Size:    last.Size,
+		})
+	}
+	return page, nil
+}
+
+// fileOrder returns the order of sortBy. Ties are broken by watch entry and
+// path, so that the order is total and a cursor is never ambiguous.
+func fileOrder(sortBy string) (func(a, b ListedFile) bool, error) {
+	key := strings.TrimPrefix(sortBy, "-")
+	descending := key != sortBy
+
+	var compare func(a, b ListedFile) int
+	switch key {
+	case "mtime":
+		compare = func(a, b ListedFile) int { return a.ModifiedTime.Compare(b.ModifiedTime) }
+	case "size":
+		compare = func(a, b ListedFile) int { return cmp.Compare(a.Size, b.Size) }
+	case "path":
+		compare = func(a, b ListedFile) int { return strings.Compare(a.Path, b.Path) }
+	default:
+		return nil, fmt.Errorf("invalid sort %q, expected mtime, size or path", sortBy)
+	}
+
+	return func(a, b ListedFile) bool {
+		c := compare(a, b)
+		if descending {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+		if a.Watch != b.Watch {
+			return a.Watch < b.Watch
+		}
+		return a.Path < b.Path
+	}, nil
+}
+
+// filterHash identifies the filters of opts, leaving out the page size and
+// the cursor itself.
+func filterHash(opts ListOptions) string {
+	filters := struct {
+		Watch         string    `json:"watch"`
+		Glob          string    `json:"glob"`
+		ModifiedSince time.Time `json:"modified_since"`
+		MinSize       *int64    `json:"min_size"`
+		MaxSize       *int64    `json:"max_size"`
+	}{opts.Watch, opts.Glob, opts.ModifiedSince.UTC(), opts.MinSize, opts.MaxSize}
+	data, _ := json.Marshal(filters)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("invalid cursor")
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("invalid cursor")
+	}
+	return c, nil
+}
@@ -0,0 +1,148 @@
+package file
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testListings() []WatchListing {
+	at := func(minute int) time.Time {
+		return time.Date(2024, 5, 1, 12, minute, 0, 0, time.UTC)
+	}
+	docs := filepath.FromSlash("/home/me/docs")
+	desk := filepath.FromSlash("/home/me/desk")
+	return []WatchListing{
+		{Watch: "docs", Root: docs, Files: []FileInfo{
+			{Path: filepath.Join(docs, "a.docx"), ModifiedTime: at(1), Size: 100},
+			{Path: filepath.Join(docs, "sub", "b.docx"), ModifiedTime: at(3), Size: 300},
+			{Path: filepath.Join(docs, "c.txt"), ModifiedTime: at(2), Size: 200},
+		}},
+		{Watch: "desk", Root: desk, Files: []FileInfo{
+			{Path: filepath.Join(desk, "d.docx"), ModifiedTime: at(3), Size: 50},
+			{Path: filepath.Join(desk, "e.txt"), ModifiedTime: at(4), Size: 10},
+		}},
+	}
+}
+
+func names(page *Page) []string {
+	var names []string
+	for _, f := range page.Files {
+		names = append(names, filepath.Base(f.Path))
+	}
+	return names
+}
+
+func TestListFilesFiltersAndSorts(t *testing.T) {
+	page, err := ListFiles(testListings(), ListOptions{})
+	require.NoError(t, err)
+	// Newest first, ties broken by watch entry.
+	assert.Equal(t, []string{"e.txt", "d.docx", "b.docx", "c.txt", "a.docx"}, names(page))
+	assert.Empty(t, page.NextCursor)
+	assert.Equal(t, "desk", page.Files[0].Watch)
+
+	minSize, maxSize := int64(50), int64(200)
+	page, err = ListFiles(testListings(), ListOptions{
+		ModifiedSince: time.Date(2024, 5, 1, 12, 2, 0, 0, time.UTC),
+		MinSize:       &minSize,
+		MaxSize:       &maxSize,
+		Sort:          "size",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"d.docx", "c.txt"}, names(page))
+
+	page, err = ListFiles(testListings(), ListOptions{Glob: "*.docx", Sort: "-path"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b.docx", "a.docx", "d.docx"}, names(page))
+
+	page, err = ListFiles(testListings(), ListOptions{Glob: "sub/**"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b.docx"}, names(page))
+
+	_, err = ListFiles(testListings(), ListOptions{Sort: "name"})
+	assert.Error(t, err)
+	_, err = ListFiles(testListings(), ListOptions{Glob: "[a-"})
+	assert.Error(t, err)
+	_, err = ListFiles(testListings(), ListOptions{Limit: 5000})
+	assert.Error(t, err)
+	_, err = ListFiles(testListings(), ListOptions{Limit: -1})
+	assert.Error(t, err)
+}
+
+func TestListFilesPages(t *testing.T) {
+	listings := testListings()
+	var all []string
+	opts := ListOptions{Sort: "mtime", Limit: 2}
+	for {
+		page, err := ListFiles(listings, opts)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(page.Files), 2)
+		all = append(all, names(page)...)
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+
+		// A file added before the cursor does not shift the next page.
+		listings[0].Files = append(listings[0].Files, FileInfo{
+			Path:         filepath.Join(listings[0].Root, "early.txt"),
+			ModifiedTime: time.Date(2024, 5, 1, 11, 0, 0, 0, time.UTC),
+		})
+	}
+	assert.Equal(t, []string{"a.docx", "c.txt", "d.docx", "b.docx", "e.txt"}, all)
+
+	_, err := ListFiles(listings, ListOptions{Sort: "size", Cursor: opts.Cursor})
+	assert.Error(t, err)
+	_, err = ListFiles(listings, ListOptions{Cursor: "not a cursor"})
+	assert.Error(t, err)
+}
+
+func TestListFilesCursorKeepsFilters(t *testing.T) {
+	minSize := int64(50)
+	opts := ListOptions{Watch: "docs", Glob: "**/*.docx", MinSize: &minSize, Limit: 1}
+	page, err := ListFiles(testListings(), opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b.docx"}, names(page))
+	require.NotEmpty(t, page.NextCursor)
+
+	opts.Cursor = page.NextCursor
+	page, err = ListFiles(testListings(), opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.docx"}, names(page))
+	assert.Empty(t, page.NextCursor)
+
+	// The page size may change, the filters may not.
+	changed := opts
+	changed.Limit = 10
+	_, err = ListFiles(testListings(), changed)
+	assert.NoError(t, err)
+	for name, change := range map[string]func(o *ListOptions){
+		"watch":          func(o *ListOptions) { o.Watch = "" },
+		"glob":           func(o *ListOptions) { o.Glob = "*.txt" },
+		"min_size":       func(o *ListOptions) { o.MinSize = nil },
+		"max_size":       func(o *ListOptions) { o.MaxSize = &minSize },
+		"modified_since": func(o *ListOptions) { o.ModifiedSince = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC) },
+	} {
+		changed := opts
+		change(&changed)
+		_, err := ListFiles(testListings(), changed)
+		assert.ErrorContains(t, err, "other filters", name)
+	}
+}
+
+func TestListingSkipsDirectories(t *testing.T) {
+	a := &File{}
+	_, ok := a.Listing()
+	assert.False(t, ok)
+
+	a.prev = &snapshot{Entries: map[string]snapshotEntry{
+		"/w/a.txt": {Size: 3, MTime: 100},
+		"/w/sub":   {MTime: 100, Dir: true},
+	}}
+	files, ok := a.Listing()
+	require.True(t, ok)
+	assert.Equal(t, []FileInfo{{Path: "/w/a.txt", ModifiedTime: time.Unix(100, 0).UTC(), Size: 3}}, files)
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package file
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// ownerOf returns the owner of a file as uid:gid.
+func ownerOf(info os.FileInfo) string {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return strconv.FormatUint(uint64(stat.Uid), 10) + ":" + strconv.FormatUint(uint64(stat.Gid), 10)
+	}
+	return ""
+}
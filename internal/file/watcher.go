@@ -0,0 +1,178 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	defaultDebounce  = 500 * time.Millisecond
+	defaultReconcile = 5 * time.Minute
+	// maxDelay bounds, in multiples of the debounce, how long a burst that
+	// never goes quiet can hold back a rescan.
+	maxDelay = 10
+)
+
+// Watcher reports the changes under the MonitorDirectory of File as they
+// happen. It watches every scanned directory with fsnotify: inotify on
+// Linux, kqueue on macOS and ReadDirectoryChangesW on Windows. Like
+// FSEvents, it only takes a notification as a hint that a directory
+// changed: once the directory has been quiet for Debounce it is rescanned
+// and compared with the last listing, so a burst of writes to one file
+// becomes one event. A full scan every Reconcile catches whatever the
+// notifications missed.
+type Watcher struct {
+	File      *File
+	Debounce  time.Duration
+	Reconcile time.Duration
+	Logger    *log.Logger
+}
+
+// Run watches until ctx is done, calling report with every batch of
+// changes, the first full scan included. It only returns an error when
+// watching could not start.
+func (w *Watcher) Run(ctx context.Context, report func(*Changes)) error {
+	debounce := w.Debounce
+	if debounce <= 0 {
+		debounce = defaultDebounce
+	}
+	reconcileInterval := w.Reconcile
+	if reconcileInterval <= 0 {
+		reconcileInterval = defaultReconcile
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	// The root is watched before the first scan so that nothing falls
+	// between the two.
+	if err := watcher.Add(w.File.MonitorDirectory); err != nil {
+		return fmt.Errorf("failed to watch %s: %w", w.File.MonitorDirectory, err)
+	}
+
+	reconcile := func() {
+		changes, err := w.File.GetFileChanges()
+		if err != nil {
+			w.Logger.Printf("Error scanning %s: %v", w.File.MonitorDirectory, err)
+			return
+		}
+		w.follow(watcher, changes)
+		report(changes)
+	}
+	reconcile()
+
+	dirty := map[string]bool{}
+	seen := map[string]*FileInfo{}
+	var burstStart time.Time
+	quiet := time.NewTimer(debounce)
+	quiet.Stop()
+	defer quiet.Stop()
+	ticker := time.NewTicker(reconcileInterval)
+	defer ticker.Stop()
+
+	flush := func() {
+		if len(dirty) == 0 {
+			return
+		}
+		dirs := make([]string, 0, len(dirty))
+		for dir := range dirty {
+			dirs = append(dirs, dir)
+		}
+		changes, err := w.File.RescanDirectories(dirs, seen)
+		dirty = map[string]bool{}
+		seen = map[string]*FileInfo{}
+		burstStart = time.Time{}
+		if err != nil {
+			w.Logger.Printf("Error rescanning %s: %v", w.File.MonitorDirectory, err)
+			return
+		}
+		w.follow(watcher, changes)
+		if len(changes.Events) > 0 {
+			report(changes)
+		}
+		// Files created in a new directory between its scan and its watch
+		// would go unnoticed until the next full scan, so look again.
+		if len(changes.Directories) > 0 {
+			for _, dir := range changes.Directories {
+				dirty[dir] = true
+			}
+			burstStart = time.Now()
+			quiet.Reset(debounce)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			// A permission change leaves size and mtime alone.
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			dirty[filepath.Dir(event.Name)] = true
+			if event.Has(fsnotify.Create) {
+				info, err := os.Lstat(event.Name)
+				switch {
+				case err != nil:
+					// Already gone again.
+					seen[event.Name] = nil
+				case !info.IsDir():
+					seen[event.Name] = &FileInfo{
+						Path:         event.Name,
+						ModifiedTime: info.ModTime().Truncate(time.Second).UTC(),
+						Size:         info.Size(),
+					}
+				}
+			}
+			if burstStart.IsZero() {
+				burstStart = time.Now()
+			}
+			if time.Since(burstStart) < maxDelay*debounce {
+				quiet.Reset(debounce)
+			}
+		case <-quiet.C:
+			flush()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			w.Logger.Printf("File watcher error on %s: %v", w.File.MonitorDirectory, err)
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				flush()
+				reconcile()
+			}
+		case <-ticker.C:
+			flush()
+			reconcile()
+		}
+	}
+}
+
+// follow starts and stops watching the directories a scan found or lost. A
+// directory that cannot be watched, for example past the inotify watch
+// limit, is still covered by the full scans.
+func (w *Watcher) follow(watcher *fsnotify.Watcher, changes *Changes) {
+	for _, dir := range changes.RemovedDirectories {
+		// A directory that is gone has already dropped its watch.
+		_ = watcher.Remove(dir)
+	}
+	for _, dir := range changes.Directories {
+		if err := watcher.Add(dir); err != nil {
+			w.Logger.Printf("Not watching %s, changes below it wait for the next full scan: %v", dir, err)
+		}
+	}
+}
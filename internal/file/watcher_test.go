@@ -0,0 +1,93 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcherReportsChanges(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "docs"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "docs", "a.txt"), []byte("a"), 0644))
+
+	var mutex sync.Mutex
+	var batches []*Changes
+	events := func() map[string]string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		types := map[string]string{}
+		for _, changes := range batches {
+			for _, e := range changes.Events {
+				types[e.Path] += e.Type + " "
+			}
+		}
+		return types
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	watcher := &Watcher{
+		File:     &File{MonitorDirectory: root, Scan: Scan{MaxDepth: -1}, Native: true},
+		Debounce: 50 * time.Millisecond,
+		Logger:   log.New(io.Discard, "", 0),
+	}
+	go watcher.Run(ctx, func(changes *Changes) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		batches = append(batches, changes)
+	})
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(batches) == 1 && batches[0].Baseline
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// A file that is gone before the rescan is still reported.
+	require.NoError(t, os.WriteFile(filepath.Join(root, "docs", "tmp.txt"), []byte("x"), 0644))
+	require.NoError(t, os.Remove(filepath.Join(root, "docs", "tmp.txt")))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "docs", "a.txt"), []byte("changed"), 0644))
+	// A new directory is scanned, and then watched.
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "new", "deep"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "new", "deep", "b.txt"), []byte("b"), 0644))
+
+	require.Eventually(t, func() bool {
+		e := events()
+		return e[filepath.Join(root, "docs", "tmp.txt")] == "created deleted " &&
+			e[filepath.Join(root, "docs", "a.txt")] == "modified " &&
+			e[filepath.Join(root, "new", "deep", "b.txt")] == "created "
+	}, 5*time.Second, 20*time.Millisecond, "events: %v", eventsString(events))
+
+	require.NoError(t, os.WriteFile(filepath.Join(root, "new", "deep", "c.txt"), []byte("c"), 0644))
+	require.Eventually(t, func() bool {
+		return events()[filepath.Join(root, "new", "deep", "c.txt")] == "created "
+	}, 5*time.Second, 20*time.Millisecond, "events: %v", eventsString(events))
+
+	require.NoError(t, os.RemoveAll(filepath.Join(root, "new")))
+	require.Eventually(t, func() bool {
+		e := events()
+		return e[filepath.Join(root, "new", "deep", "c.txt")] == "created deleted " &&
+			e[filepath.Join(root, "new")] == "created deleted "
+	}, 5*time.Second, 20*time.Millisecond, "events: %v", eventsString(events))
+	mutex.Lock()
+	last := batches[len(batches)-1]
+	mutex.Unlock()
+	assert.Equal(t, 2, last.FileCount)
+}
+
+func eventsString(events func() map[string]string) fmt.Stringer {
+	return stringer(func() string { return fmt.Sprint(events()) })
+}
+
+type stringer func() string
+
+func (s stringer) String() string { return s() }
@@ -0,0 +1,239 @@
+package monitor
+
+import (
+	"daemon/internal/osql"
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"strconv"
+
+	"github.com/osquery/osquery-go"
+)
+
+type CPUUsage struct {
+	Core          string  `json:"core"`
+	UsagePercent  float64 `json:"usage_percent"`
+	UserPercent   float64 `json:"user_percent"`
+	SystemPercent float64 `json:"system_percent"`
+	IOWaitPercent float64 `json:"iowait_percent"`
+	IdlePercent   float64 `json:"idle_percent"`
+}
+
+type LoadAverage struct {
+	One     float64 `json:"1m"`
+	Five    float64 `json:"5m"`
+	Fifteen float64 `json:"15m"`
+}
+
+type CPUStats struct {
+	Overall     CPUUsage     `json:"overall"`
+	Cores       []CPUUsage   `json:"cores"`
+	LoadAverage *LoadAverage `json:"load_average"`
+}
+
+// cpuTimes holds the cumulative tick counters osquery reports for one core
+// in the cpu_time table. They only mean something as a difference between
+// two samples.
+type cpuTimes struct {
+	user    float64
+	nice    float64
+	system  float64
+	idle    float64
+	iowait  float64
+	irq     float64
+	softirq float64
+	steal   float64
+}
+
+func (t cpuTimes) total() float64 {
+	return t.user + t.nice + t.system + t.idle + t.iowait + t.irq + t.softirq + t.steal
+}
+
+func (t cpuTimes) sub(prev cpuTimes) cpuTimes {
+	return cpuTimes{
+		user:    t.user - prev.user,
+		nice:    t.nice - prev.nice,
+		system:  t.system - prev.system,
+		idle:    t.idle - prev.idle,
+		iowait:  t.iowait - prev.iowait,
+		irq:     t.irq - prev.irq,
+		softirq: t.softirq - prev.softirq,
+		steal:   t.steal - prev.steal,
+	}
+}
+
+func (t cpuTimes) add(other cpuTimes) cpuTimes {
+	return cpuTimes{
+		user:    t.user + other.user,
+		nice:    t.nice + other.nice,
+		system:  t.system + other.system,
+		idle:    t.idle + other.idle,
+		iowait:  t.iowait + other.iowait,
+		irq:     t.irq + other.irq,
+		softirq: t.softirq + other.softirq,
+		steal:   t.steal + other.steal,
+	}
+}
+
+// usage turns a delta between two samples into percentages of the elapsed
+// ticks. It reports false when no time elapsed or a counter went backwards.
+func (t cpuTimes) usage(core string) (CPUUsage, bool) {
+	total := t.total()
+	if total <= 0 || t.user < 0 || t.nice < 0 || t.system < 0 || t.idle < 0 || t.iowait < 0 {
+		return CPUUsage{}, false
+	}
+	pct := func(v float64) float64 {
+		return round2(v * 100 / total)
+	}
+	return CPUUsage{
+		Core:          core,
+		UsagePercent:  pct(total - t.idle - t.iowait),
+		UserPercent:   pct(t.user + t.nice),
+		SystemPercent: pct(t.system + t.irq + t.softirq),
+		IOWaitPercent: pct(t.iowait),
+		IdlePercent:   pct(t.idle),
+	}, true
+}
+
+func parseCPUTimes(rows []map[string]string) map[string]cpuTimes {
+	samples := make(map[string]cpuTimes, len(rows))
+	for _, r := range rows {
+		samples[r["core"]] = cpuTimes{
+			user:    parseFloat(r["user"]),
+			nice:    parseFloat(r["nice"]),
+			system:  parseFloat(r["system"]),
+			idle:    parseFloat(r["idle"]),
+			iowait:  parseFloat(r["iowait"]),
+			irq:     parseFloat(r["irq"]),
+			softirq: parseFloat(r["softirq"]),
+			steal:   parseFloat(r["steal"]),
+		}
+	}
+	return samples
+}
+
+// cpuUsageBetween computes overall and per core utilisation from two
+// consecutive cpu_time samples. Cores missing from either sample are skipped.
+func cpuUsageBetween(prev, curr map[string]cpuTimes) (*CPUStats, bool) {
+	var overall cpuTimes
+	stats := &CPUStats{}
+	for core, now := range curr {
+		before, ok := prev[core]
+		if !ok {
+			continue
+		}
+		delta := now.sub(before)
+		usage, ok := delta.usage(core)
+		if !ok {
+			continue
+		}
+		overall = overall.add(delta)
+		stats.Cores = append(stats.Cores, usage)
+	}
+	if len(stats.Cores) == 0 {
+		return nil, false
+	}
+	sort.Slice(stats.Cores, func(i, j int) bool {
+		return coreLess(stats.Cores[i].Core, stats.Cores[j].Core)
+	})
+	stats.Overall, _ = overall.usage("all")
+	return stats, true
+}
+
+func (a *Monitor) getCPUStats(client *osquery.ExtensionManagerClient) (*CPUStats, error) {
+	if runtime.GOOS == "windows" {
+		return getWindowsCPUStats(client)
+	}
+
+	cpuResponse, err := client.Query(osql.MustBuild("SELECT core, user, nice, system, idle, iowait, irq, softirq, steal FROM cpu_time"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query CPU times: %w", err)
+	}
+
+	var loadRows []map[string]string
+	loadResponse, err := client.Query(osql.MustBuild("SELECT period, average FROM load_average"))
+	if err == nil {
+		loadRows = loadResponse.Response
+	}
+
+	return a.cpuStats(cpuResponse.Response, loadRows), nil
+}
+
+// cpuStats turns cpu_time and load_average rows into a report. It returns
+// nil on the first sample since start, when there is nothing to compare
+// against yet.
+func (a *Monitor) cpuStats(cpuRows, loadRows []map[string]string) *CPUStats {
+	curr := parseCPUTimes(cpuRows)
+	prev := a.prevCPU
+	a.prevCPU = curr
+
+	stats, ok := cpuUsageBetween(prev, curr)
+	if !ok {
+		return nil
+	}
+
+	if len(loadRows) > 0 {
+		load := &LoadAverage{}
+		for _, r := range loadRows {
+			switch r["period"] {
+			case "1m":
+				load.One = parseFloat(r["average"])
+			case "5m":
+				load.Five = parseFloat(r["average"])
+			case "15m":
+				load.Fifteen = parseFloat(r["average"])
+			}
+		}
+		stats.LoadAverage = load
+	}
+	return stats
+}
+
+// getWindowsCPUStats falls back to the load percentage Windows reports per
+// processor, since osquery has no cpu_time table there.
+func getWindowsCPUStats(client *osquery.ExtensionManagerClient) (*CPUStats, error) {
+	response, err := client.Query(osql.MustBuild("SELECT device_id, load_percentage FROM cpu_info"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query CPU load: %w", err)
+	}
+	if len(response.Response) == 0 {
+		return nil, nil
+	}
+
+	stats := &CPUStats{}
+	var sum float64
+	for _, r := range response.Response {
+		load := parseFloat(r["load_percentage"])
+		sum += load
+		stats.Cores = append(stats.Cores, CPUUsage{
+			Core:         r["device_id"],
+			UsagePercent: load,
+			IdlePercent:  round2(100 - load),
+		})
+	}
+	avg := round2(sum / float64(len(stats.Cores)))
+	stats.Overall = CPUUsage{Core: "all", UsagePercent: avg, IdlePercent: round2(100 - avg)}
+	return stats, nil
+}
+
+func coreLess(a, b string) bool {
+	ai, aerr := strconv.Atoi(a)
+	bi, berr := strconv.Atoi(b)
+	if aerr == nil && berr == nil {
+		return ai < bi
+	}
+	return a < b
+}
+
+func parseFloat(s string) float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
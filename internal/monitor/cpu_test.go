@@ -0,0 +1,48 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCPUUsageBetween(t *testing.T) {
+	prev := map[string]cpuTimes{
+		"0": {user: 100, system: 50, idle: 800, iowait: 50},
+		"1": {user: 200, system: 100, idle: 600, iowait: 100},
+	}
+	curr := map[string]cpuTimes{
+		"0": {user: 160, system: 70, idle: 910, iowait: 60},
+		"1": {user: 200, system: 100, idle: 700, iowait: 100},
+	}
+
+	stats, ok := cpuUsageBetween(prev, curr)
+	assert.True(t, ok)
+	assert.Len(t, stats.Cores, 2)
+
+	core0 := stats.Cores[0]
+	assert.Equal(t, "0", core0.Core)
+	assert.Equal(t, 30.0, core0.UserPercent)
+	assert.Equal(t, 10.0, core0.SystemPercent)
+	assert.Equal(t, 5.0, core0.IOWaitPercent)
+	assert.Equal(t, 55.0, core0.IdlePercent)
+	assert.Equal(t, 40.0, core0.UsagePercent)
+
+	assert.Equal(t, 0.0, stats.Cores[1].UsagePercent)
+	assert.Equal(t, 100.0, stats.Cores[1].IdlePercent)
+
+	assert.Equal(t, "all", stats.Overall.Core)
+	assert.Equal(t, 26.67, stats.Overall.UsagePercent)
+}
+
+func TestCPUUsageBetweenFirstSample(t *testing.T) {
+	_, ok := cpuUsageBetween(nil, map[string]cpuTimes{"0": {user: 1, idle: 1}})
+	assert.False(t, ok)
+}
+
+func TestCPUUsageBetweenCounterReset(t *testing.T) {
+	prev := map[string]cpuTimes{"0": {user: 500, idle: 500}}
+	curr := map[string]cpuTimes{"0": {user: 10, idle: 20}}
+	_, ok := cpuUsageBetween(prev, curr)
+	assert.False(t, ok)
+}
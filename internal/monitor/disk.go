@@ -0,0 +1,208 @@
+package monitor
+
+import (
+	"daemon/internal/osql"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/osquery/osquery-go"
+)
+
+type MountUsage struct {
+	Path        string  `json:"path"`
+	Device      string  `json:"device"`
+	Type        string  `json:"type"`
+	TotalBytes  uint64  `json:"total_bytes"`
+	UsedBytes   uint64  `json:"used_bytes"`
+	FreeBytes   uint64  `json:"free_bytes"`
+	UsedPercent float64 `json:"used_percent"`
+	InodesTotal *uint64 `json:"inodes_total"`
+	InodesUsed  *uint64 `json:"inodes_used"`
+	InodesFree  *uint64 `json:"inodes_free"`
+}
+
+type DiskStats struct {
+	Mounts []MountUsage `json:"mounts"`
+	// MonitoredMount is the path of the mount holding MonitorDirectory.
+	MonitoredMount string `json:"monitored_mount,omitempty"`
+}
+
+// pseudoFilesystems are skipped unless IncludePseudoFilesystems is set. They
+// either have no backing storage or report the usage of another mount.
+// overlay is not one of them: it is the root filesystem in containers.
+var pseudoFilesystems = map[string]bool{
+	"autofs":      true,
+	"binfmt_misc": true,
+	"bpf":         true,
+	"cgroup":      true,
+	"cgroup2":     true,
+	"configfs":    true,
+	"debugfs":     true,
+	"devfs":       true,
+	"devpts":      true,
+	"devtmpfs":    true,
+	"fusectl":     true,
+	"hugetlbfs":   true,
+	"mqueue":      true,
+	"nsfs":        true,
+	"proc":        true,
+	"pstore":      true,
+	"securityfs":  true,
+	"squashfs":    true,
+	"sysfs":       true,
+	"tmpfs":       true,
+	"tracefs":     true,
+}
+
+func (a *Monitor) getDiskStats(client *osquery.ExtensionManagerClient) (*DiskStats, error) {
+	var mounts []MountUsage
+	var err error
+	if runtime.GOOS == "windows" {
+		mounts, err = getLogicalDrives(client)
+	} else {
+		mounts, err = getMounts(client)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a.diskStats(mounts), nil
+}
+
+// diskStats picks the mount of the monitored directory and drops pseudo
+// filesystems unless they were asked for.
+func (a *Monitor) diskStats(mounts []MountUsage) *DiskStats {
+	stats := &DiskStats{}
+	monitored := mountFor(mounts, a.MonitorDirectory)
+	if monitored != nil {
+		stats.MonitoredMount = monitored.Path
+	}
+	for _, m := range mounts {
+		if !a.IncludePseudoFilesystems && isPseudoMount(m) && (monitored == nil || m.Path != monitored.Path) {
+			continue
+		}
+		stats.Mounts = append(stats.Mounts, m)
+	}
+	return stats
+}
+
+// Monitored returns the usage of the mount holding the monitored directory.
+func (s *DiskStats) Monitored() *MountUsage {
+	for i := range s.Mounts {
+		if s.Mounts[i].Path == s.MonitoredMount {
+			return &s.Mounts[i]
+		}
+	}
+	return nil
+}
+
+func getMounts(client *osquery.ExtensionManagerClient) ([]MountUsage, error) {
+	response, err := client.Query(osql.MustBuild("SELECT path, device, type, blocks_size, blocks, blocks_free, blocks_available, inodes, inodes_free FROM mounts"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query mounts: %w", err)
+	}
+	return mountsFromRows(response.Response), nil
+}
+
+// mountsFromRows converts rows shaped like the osquery mounts table.
+func mountsFromRows(rows []map[string]string) []MountUsage {
+	mounts := make([]MountUsage, 0, len(rows))
+	for _, r := range rows {
+		blockSize := parseUint(r["blocks_size"])
+		blocks := parseUint(r["blocks"])
+		blocksFree := parseUint(r["blocks_free"])
+		blocksAvailable := parseUint(r["blocks_available"])
+		inodes := parseUint(r["inodes"])
+		inodesFree := parseUint(r["inodes_free"])
+		inodesUsed := subFloor(inodes, inodesFree)
+
+		m := MountUsage{
+			Path:        r["path"],
+			Device:      r["device"],
+			Type:        r["type"],
+			TotalBytes:  blocks * blockSize,
+			UsedBytes:   subFloor(blocks, blocksFree) * blockSize,
+			FreeBytes:   blocksAvailable * blockSize,
+			InodesTotal: &inodes,
+			InodesUsed:  &inodesUsed,
+			InodesFree:  &inodesFree,
+		}
+		m.UsedPercent = usedPercent(m.UsedBytes, m.FreeBytes)
+		mounts = append(mounts, m)
+	}
+	return mounts
+}
+
+func getLogicalDrives(client *osquery.ExtensionManagerClient) ([]MountUsage, error) {
+	response, err := client.Query(osql.MustBuild("SELECT device_id, type, file_system, size, free_space FROM logical_drives"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query logical_drives: %w", err)
+	}
+
+	mounts := make([]MountUsage, 0, len(response.Response))
+	for _, r := range response.Response {
+		total := parseUint(r["size"])
+		free := parseUint(r["free_space"])
+		m := MountUsage{
+			Path:       r["device_id"] + `\`,
+			Device:     r["device_id"],
+			Type:       r["file_system"],
+			TotalBytes: total,
+			UsedBytes:  subFloor(total, free),
+			FreeBytes:  free,
+		}
+		m.UsedPercent = usedPercent(m.UsedBytes, m.FreeBytes)
+		mounts = append(mounts, m)
+	}
+	return mounts, nil
+}
+
+// usedPercent matches df: space reserved for root counts as neither used nor
+// available.
+func usedPercent(used, free uint64) float64 {
+	if used+free == 0 {
+		return 0
+	}
+	return round2(float64(used) * 100 / float64(used+free))
+}
+
+func isPseudoMount(m MountUsage) bool {
+	return pseudoFilesystems[m.Type] || m.TotalBytes == 0
+}
+
+// mountFor returns the mount with the longest path that contains dir.
+func mountFor(mounts []MountUsage, dir string) *MountUsage {
+	if dir == "" {
+		return nil
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+
+	var best *MountUsage
+	for i := range mounts {
+		if !pathWithin(dir, mounts[i].Path) {
+			continue
+		}
+		if best == nil || len(mounts[i].Path) > len(best.Path) {
+			best = &mounts[i]
+		}
+	}
+	return best
+}
+
+func pathWithin(path, root string) bool {
+	if runtime.GOOS == "windows" {
+		path = strings.ToLower(path)
+		root = strings.ToLower(root)
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
@@ -0,0 +1,30 @@
+package monitor
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMountFor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix mount paths")
+	}
+	mounts := []MountUsage{
+		{Path: "/"},
+		{Path: "/home"},
+		{Path: "/home/user/share"},
+		{Path: "/homework"},
+	}
+
+	assert.Equal(t, "/home", mountFor(mounts, "/home/user/Documents/missing").Path)
+	assert.Equal(t, "/home/user/share", mountFor(mounts, "/home/user/share").Path)
+	assert.Equal(t, "/", mountFor(mounts, "/var/missing").Path)
+	assert.Nil(t, mountFor(mounts, ""))
+}
+
+func TestUsedPercent(t *testing.T) {
+	assert.Equal(t, 25.0, usedPercent(25, 75))
+	assert.Equal(t, 0.0, usedPercent(0, 0))
+}
@@ -0,0 +1,160 @@
+package monitor
+
+import (
+	"daemon/internal/osql"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/osquery/osquery-go"
+)
+
+// Inventory describes the host itself: hardware, operating system and
+// addresses. It rarely changes, so it is collected at startup and then on a
+// slow schedule.
+type Inventory struct {
+	OsqueryInstance   *osquery.ExtensionManagerServer
+	OsquerySocketPath string
+	// Native reads /proc, /sys and /etc/os-release instead of querying
+	// osquery. It is only available on Linux.
+	Native bool
+}
+
+// HostInventory fields are empty when the platform does not report them.
+type HostInventory struct {
+	Hostname         string   `json:"hostname"`
+	UUID             string   `json:"uuid"`
+	HardwareVendor   string   `json:"hardware_vendor"`
+	HardwareModel    string   `json:"hardware_model"`
+	FirmwareVendor   string   `json:"firmware_vendor"`
+	FirmwareVersion  string   `json:"firmware_version"`
+	CPUModel         string   `json:"cpu_model"`
+	CPUPhysicalCores int      `json:"cpu_physical_cores"`
+	CPULogicalCores  int      `json:"cpu_logical_cores"`
+	MemoryBytes      uint64   `json:"memory_bytes"`
+	OSName           string   `json:"os_name"`
+	OSVersion        string   `json:"os_version"`
+	OSBuild          string   `json:"os_build"`
+	Platform         string   `json:"platform"`
+	Arch             string   `json:"arch"`
+	KernelVersion    string   `json:"kernel_version"`
+	PrimaryIPs       []string `json:"primary_ips"`
+}
+
+func (a *Inventory) GetHostInventory() (*HostInventory, error) {
+	if a.Native {
+		return nativeHostInventory()
+	}
+	if a.OsqueryInstance == nil {
+		return nil, fmt.Errorf("osquery instance not initialized")
+	}
+
+	client, err := osquery.NewClient(a.OsquerySocketPath, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create osquery client: %w", err)
+	}
+	defer client.Close()
+
+	// system_info and os_version exist everywhere. The other tables depend
+	// on the platform and the osquery version, so they are best effort.
+	query := func(sql string, required bool) (map[string]string, []map[string]string, error) {
+		response, err := client.Query(sql)
+		if err == nil && response.GetStatus() != nil && response.GetStatus().Code != 0 {
+			err = fmt.Errorf("%s", response.GetStatus().Message)
+		}
+		if err != nil {
+			if required {
+				return nil, nil, fmt.Errorf("failed to query %q: %w", sql, err)
+			}
+			return map[string]string{}, nil, nil
+		}
+		if len(response.Response) == 0 {
+			return map[string]string{}, nil, nil
+		}
+		return response.Response[0], response.Response, nil
+	}
+
+	system, _, err := query(osql.MustBuild("SELECT hostname, uuid, cpu_brand, cpu_physical_cores, cpu_logical_cores, physical_memory, hardware_vendor, hardware_model FROM system_info"), true)
+	if err != nil {
+		return nil, err
+	}
+	osVersion, _, err := query(osql.MustBuild("SELECT name, version, build, platform, arch FROM os_version"), true)
+	if err != nil {
+		return nil, err
+	}
+	cpu, _, _ := query(osql.MustBuild("SELECT model, number_of_cores, logical_processors FROM cpu_info"), false)
+	firmware, _, _ := query(osql.MustBuild("SELECT vendor, version FROM platform_info"), false)
+	kernel, _, _ := query(osql.MustBuild("SELECT version FROM kernel_info"), false)
+	_, addresses, _ := query(osql.MustBuild("SELECT address FROM interface_addresses"), false)
+
+	inventory := &HostInventory{
+		Hostname:         system["hostname"],
+		UUID:             system["uuid"],
+		HardwareVendor:   strings.TrimSpace(system["hardware_vendor"]),
+		HardwareModel:    strings.TrimSpace(system["hardware_model"]),
+		FirmwareVendor:   firmware["vendor"],
+		FirmwareVersion:  firmware["version"],
+		CPUModel:         strings.TrimSpace(system["cpu_brand"]),
+		CPUPhysicalCores: int(parseUint(system["cpu_physical_cores"])),
+		CPULogicalCores:  int(parseUint(system["cpu_logical_cores"])),
+		MemoryBytes:      parseUint(system["physical_memory"]),
+		OSName:           osVersion["name"],
+		OSVersion:        osVersion["version"],
+		OSBuild:          osVersion["build"],
+		Platform:         osVersion["platform"],
+		Arch:             osVersion["arch"],
+		KernelVersion:    kernel["version"],
+	}
+	if inventory.CPUModel == "" {
+		inventory.CPUModel = strings.TrimSpace(cpu["model"])
+	}
+	if inventory.CPUPhysicalCores == 0 {
+		inventory.CPUPhysicalCores, _ = strconv.Atoi(cpu["number_of_cores"])
+	}
+	if inventory.CPULogicalCores == 0 {
+		inventory.CPULogicalCores, _ = strconv.Atoi(cpu["logical_processors"])
+	}
+
+	ips := make([]string, 0, len(addresses))
+	for _, r := range addresses {
+		ips = append(ips, r["address"])
+	}
+	inventory.PrimaryIPs = primaryIPs(ips)
+
+	log.Println("Updated host inventory")
+	return inventory, nil
+}
+
+// primaryIPs keeps the addresses other hosts can reach this one on, IPv4
+// first. Loopback, link-local and unspecified addresses are dropped.
+func primaryIPs(addresses []string) []string {
+	seen := map[string]bool{}
+	ips := []net.IP{}
+	for _, address := range addresses {
+		// Strip a zone such as %eth0 and a prefix length such as /24.
+		address, _, _ = strings.Cut(address, "%")
+		address, _, _ = strings.Cut(address, "/")
+		ip := net.ParseIP(address)
+		if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() || ip.IsMulticast() {
+			continue
+		}
+		if seen[ip.String()] {
+			continue
+		}
+		seen[ip.String()] = true
+		ips = append(ips, ip)
+	}
+
+	sort.SliceStable(ips, func(i, j int) bool {
+		return ips[i].To4() != nil && ips[j].To4() == nil
+	})
+	result := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		result = append(result, ip.String())
+	}
+	return result
+}
@@ -0,0 +1,153 @@
+package monitor
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// sysDir and etcDir are where the native inventory reads DMI data and the
+// OS release from.
+var (
+	sysDir = "/sys"
+	etcDir = "/etc"
+)
+
+func nativeHostInventory() (*HostInventory, error) {
+	inventory := &HostInventory{
+		HardwareVendor:  readTrimmed(filepath.Join(sysDir, "class/dmi/id/sys_vendor")),
+		HardwareModel:   readTrimmed(filepath.Join(sysDir, "class/dmi/id/product_name")),
+		FirmwareVendor:  readTrimmed(filepath.Join(sysDir, "class/dmi/id/bios_vendor")),
+		FirmwareVersion: readTrimmed(filepath.Join(sysDir, "class/dmi/id/bios_version")),
+	}
+
+	var err error
+	inventory.Hostname, err = os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	// product_uuid is only readable by root; machine-id identifies the
+	// installation rather than the hardware, but is always there.
+	inventory.UUID = readTrimmed(filepath.Join(sysDir, "class/dmi/id/product_uuid"))
+	if inventory.UUID == "" {
+		inventory.UUID = readTrimmed(filepath.Join(etcDir, "machine-id"))
+	}
+
+	cpuinfo, err := os.ReadFile(filepath.Join(procDir, "cpuinfo"))
+	if err != nil {
+		return nil, err
+	}
+	inventory.CPUModel, inventory.CPUPhysicalCores, inventory.CPULogicalCores = parseCPUInfo(cpuinfo)
+
+	memory, err := readProcFile("meminfo", parseProcMeminfo)
+	if err != nil {
+		return nil, err
+	}
+	inventory.MemoryBytes = parseUint(memory[0]["memory_total"])
+
+	if release, err := os.ReadFile(filepath.Join(etcDir, "os-release")); err == nil {
+		fields := parseOSRelease(release)
+		inventory.OSName = fields["NAME"]
+		inventory.OSVersion = fields["VERSION_ID"]
+		inventory.OSBuild = fields["BUILD_ID"]
+		inventory.Platform = fields["ID"]
+	}
+
+	var uts syscall.Utsname
+	if err := syscall.Uname(&uts); err == nil {
+		inventory.KernelVersion = utsString(uts.Release[:])
+		inventory.Arch = utsString(uts.Machine[:])
+	}
+
+	addresses, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		ips = append(ips, address.String())
+	}
+	inventory.PrimaryIPs = primaryIPs(ips)
+
+	log.Println("Updated host inventory")
+	return inventory, nil
+}
+
+func readTrimmed(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// parseCPUInfo counts logical processors, and physical cores by their
+// distinct physical id and core id pairs.
+func parseCPUInfo(data []byte) (model string, physical, logical int) {
+	cores := map[string]bool{}
+	var physicalID string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "processor":
+			logical++
+		case "model name":
+			if model == "" {
+				model = value
+			}
+		case "physical id":
+			physicalID = value
+		case "core id":
+			cores[physicalID+"/"+value] = true
+		}
+	}
+	physical = len(cores)
+	if physical == 0 {
+		physical = logical
+	}
+	return model, physical, logical
+}
+
+// parseOSRelease reads the KEY=value lines of os-release(5).
+func parseOSRelease(data []byte) map[string]string {
+	fields := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `'"`)
+		}
+		fields[key] = value
+	}
+	return fields
+}
+
+// utsString converts a NUL terminated utsname field, whose element type
+// differs between architectures.
+func utsString[T int8 | uint8](field []T) string {
+	b := make([]byte, 0, len(field))
+	for _, c := range field {
+		if c == 0 {
+			break
+		}
+		b = append(b, byte(c))
+	}
+	return string(b)
+}
@@ -0,0 +1,39 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCPUInfo(t *testing.T) {
+	model, physical, logical := parseCPUInfo([]byte(`processor	: 0
+model name	: Intel(R) Xeon(R) CPU
+physical id	: 0
+core id		: 0
+
+processor	: 1
+model name	: Intel(R) Xeon(R) CPU
+physical id	: 0
+core id		: 0
+
+processor	: 2
+model name	: Intel(R) Xeon(R) CPU
+physical id	: 0
+core id		: 1
+`))
+	assert.Equal(t, "Intel(R) Xeon(R) CPU", model)
+	assert.Equal(t, 2, physical)
+	assert.Equal(t, 3, logical)
+}
+
+func TestParseOSRelease(t *testing.T) {
+	fields := parseOSRelease([]byte(`NAME="Ubuntu"
+VERSION_ID="24.04"
+ID=ubuntu
+# comment
+`))
+	assert.Equal(t, "Ubuntu", fields["NAME"])
+	assert.Equal(t, "24.04", fields["VERSION_ID"])
+	assert.Equal(t, "ubuntu", fields["ID"])
+}
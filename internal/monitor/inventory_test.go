@@ -0,0 +1,21 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrimaryIPs(t *testing.T) {
+	ips := primaryIPs([]string{
+		"127.0.0.1",
+		"::1",
+		"fe80::1%eth0",
+		"2001:db8::10/64",
+		"169.254.3.4",
+		"10.0.0.5/24",
+		"10.0.0.5",
+		"192.168.1.20",
+	})
+	assert.Equal(t, []string{"10.0.0.5", "192.168.1.20", "2001:db8::10"}, ips)
+}
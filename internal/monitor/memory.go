@@ -0,0 +1,139 @@
+package monitor
+
+import (
+	"daemon/internal/osql"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+
+	"github.com/osquery/osquery-go"
+)
+
+// MemoryStats is reported in bytes. Fields the platform's osquery tables do
+// not expose are left nil rather than guessed.
+type MemoryStats struct {
+	TotalBytes     uint64   `json:"total_bytes"`
+	UsedBytes      *uint64  `json:"used_bytes"`
+	AvailableBytes *uint64  `json:"available_bytes"`
+	CachedBytes    *uint64  `json:"cached_bytes"`
+	BuffersBytes   *uint64  `json:"buffers_bytes"`
+	SwapTotalBytes *uint64  `json:"swap_total_bytes"`
+	SwapUsedBytes  *uint64  `json:"swap_used_bytes"`
+	UsedPercent    *float64 `json:"used_percent"`
+}
+
+func (a *Monitor) getMemoryStats(client *osquery.ExtensionManagerClient) (*MemoryStats, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		return getDarwinMemoryStats(client)
+	case "windows":
+		return getPhysicalMemoryStats(client)
+	default:
+		return getLinuxMemoryStats(client)
+	}
+}
+
+// getLinuxMemoryStats reads memory_info, which mirrors /proc/meminfo.
+func getLinuxMemoryStats(client *osquery.ExtensionManagerClient) (*MemoryStats, error) {
+	response, err := client.Query(osql.MustBuild("SELECT memory_total, memory_free, memory_available, buffers, cached, swap_total, swap_free FROM memory_info"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query memory_info: %w", err)
+	}
+	if len(response.Response) == 0 {
+		return nil, fmt.Errorf("memory_info returned no rows")
+	}
+	return linuxMemoryStats(response.Response[0]), nil
+}
+
+func linuxMemoryStats(r map[string]string) *MemoryStats {
+	total := parseUint(r["memory_total"])
+	free := parseUint(r["memory_free"])
+	buffers := parseUint(r["buffers"])
+	cached := parseUint(r["cached"])
+	available := parseUint(r["memory_available"])
+	if available == 0 {
+		// Kernels older than 3.14 have no MemAvailable.
+		available = free + buffers + cached
+	}
+	swapTotal := parseUint(r["swap_total"])
+	swapUsed := subFloor(swapTotal, parseUint(r["swap_free"]))
+
+	stats := &MemoryStats{
+		TotalBytes:     total,
+		AvailableBytes: &available,
+		CachedBytes:    &cached,
+		BuffersBytes:   &buffers,
+		SwapTotalBytes: &swapTotal,
+		SwapUsedBytes:  &swapUsed,
+	}
+	stats.setUsed(subFloor(total, available))
+	return stats
+}
+
+// getDarwinMemoryStats combines the physical memory size from system_info
+// with the page counters in virtual_memory_info. osquery does not expose swap
+// usage on macOS.
+func getDarwinMemoryStats(client *osquery.ExtensionManagerClient) (*MemoryStats, error) {
+	stats, err := getPhysicalMemoryStats(client)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := client.Query(osql.MustBuild("SELECT free, inactive, speculative, file_backed FROM virtual_memory_info"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query virtual_memory_info: %w", err)
+	}
+	if len(response.Response) == 0 {
+		return stats, nil
+	}
+
+	setDarwinPages(stats, response.Response[0], uint64(os.Getpagesize()))
+	return stats, nil
+}
+
+// setDarwinPages fills in what the page counters of virtual_memory_info
+// tell: free, inactive and speculative pages can be reclaimed.
+func setDarwinPages(stats *MemoryStats, r map[string]string, pageSize uint64) {
+	available := (parseUint(r["free"]) + parseUint(r["inactive"]) + parseUint(r["speculative"])) * pageSize
+	cached := parseUint(r["file_backed"]) * pageSize
+	stats.AvailableBytes = &available
+	stats.CachedBytes = &cached
+	stats.setUsed(subFloor(stats.TotalBytes, available))
+}
+
+// getPhysicalMemoryStats only knows the installed memory. It is all osquery
+// offers on Windows.
+func getPhysicalMemoryStats(client *osquery.ExtensionManagerClient) (*MemoryStats, error) {
+	response, err := client.Query(osql.MustBuild("SELECT physical_memory FROM system_info"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query system_info: %w", err)
+	}
+	if len(response.Response) == 0 {
+		return nil, fmt.Errorf("system_info returned no rows")
+	}
+	return &MemoryStats{TotalBytes: parseUint(response.Response[0]["physical_memory"])}, nil
+}
+
+func (s *MemoryStats) setUsed(used uint64) {
+	s.UsedBytes = &used
+	if s.TotalBytes > 0 {
+		pct := round2(float64(used) * 100 / float64(s.TotalBytes))
+		s.UsedPercent = &pct
+	}
+}
+
+func parseUint(s string) uint64 {
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+func subFloor(a, b uint64) uint64 {
+	if b > a {
+		return 0
+	}
+	return a - b
+}
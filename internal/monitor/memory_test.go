@@ -0,0 +1,64 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinuxMemoryStats(t *testing.T) {
+	stats := linuxMemoryStats(map[string]string{
+		"memory_total":     "1000",
+		"memory_free":      "100",
+		"memory_available": "600",
+		"buffers":          "50",
+		"cached":           "200",
+		"swap_total":       "400",
+		"swap_free":        "300",
+	})
+	assert.Equal(t, uint64(1000), stats.TotalBytes)
+	// MemAvailable wins over free + buffers + cached.
+	assert.Equal(t, uint64(600), *stats.AvailableBytes)
+	assert.Equal(t, uint64(400), *stats.UsedBytes)
+	assert.Equal(t, 40.0, *stats.UsedPercent)
+	assert.Equal(t, uint64(200), *stats.CachedBytes)
+	assert.Equal(t, uint64(50), *stats.BuffersBytes)
+	assert.Equal(t, uint64(100), *stats.SwapUsedBytes)
+}
+
+func TestLinuxMemoryStatsWithoutMemAvailable(t *testing.T) {
+	stats := linuxMemoryStats(map[string]string{
+		"memory_total":     "1000",
+		"memory_free":      "100",
+		"memory_available": "0",
+		"buffers":          "50",
+		"cached":           "200",
+		"swap_total":       "0",
+		"swap_free":        "0",
+	})
+	assert.Equal(t, uint64(350), *stats.AvailableBytes)
+	assert.Equal(t, uint64(650), *stats.UsedBytes)
+	assert.Equal(t, 65.0, *stats.UsedPercent)
+	assert.Equal(t, uint64(0), *stats.SwapUsedBytes)
+}
+
+func TestSetDarwinPages(t *testing.T) {
+	stats := &MemoryStats{TotalBytes: 16384 * 100}
+	setDarwinPages(stats, map[string]string{
+		"free":        "10",
+		"inactive":    "15",
+		"speculative": "5",
+		"file_backed": "20",
+	}, 16384)
+	require.NotNil(t, stats.AvailableBytes)
+	assert.Equal(t, uint64(30*16384), *stats.AvailableBytes)
+	assert.Equal(t, uint64(20*16384), *stats.CachedBytes)
+	assert.Equal(t, uint64(70*16384), *stats.UsedBytes)
+	assert.Equal(t, 70.0, *stats.UsedPercent)
+
+	// Counters larger than the total do not wrap the used bytes.
+	stats = &MemoryStats{TotalBytes: 100}
+	setDarwinPages(stats, map[string]string{"free": "1000"}, 1)
+	assert.Equal(t, uint64(0), *stats.UsedBytes)
+}
@@ -1,9 +1,10 @@
 package monitor
 
 import (
-	"encoding/json"
+	"daemon/internal/osql"
 	"fmt"
 	"log"
+	"strconv"
 	"time"
 
 	"github.com/osquery/osquery-go"
@@ -13,83 +14,86 @@ type Monitor struct {
 	OsqueryInstance   *osquery.ExtensionManagerServer
 	OsquerySocketPath string
 	MonitorDirectory  string
+	// IncludePseudoFilesystems keeps proc, tmpfs, cgroup and similar mounts
+	// in the disk report.
+	IncludePseudoFilesystems bool
+	// Native reads /proc and statfs directly instead of querying osquery.
+	// It is only available on Linux.
+	Native bool
+
+	prevCPU map[string]cpuTimes
 }
 
+// SystemStats summary fields are null when the platform cannot provide them.
 type SystemStats struct {
-	CPUUsage     string `json:"cpu_usage"`
-	MemoryUsage  string `json:"memory_usage"`
-	DiskUsage    string `json:"disk_usage"`
-	SystemUptime string `json:"system_uptime"`
+	CPUPercent        *float64     `json:"cpu_percent"`
+	MemoryUsedPercent *float64     `json:"memory_used_percent"`
+	DiskUsedPercent   *float64     `json:"disk_used_percent"`
+	UptimeSeconds     *uint64      `json:"uptime_seconds"`
+	CPU               *CPUStats    `json:"cpu"`
+	Memory            *MemoryStats `json:"memory"`
+	Disk              *DiskStats   `json:"disk"`
 }
 
-func (a *Monitor) GetSystemMonitoringData() (string, error) {
+func (a *Monitor) GetSystemMonitoringData() (*SystemStats, error) {
+	if a.Native {
+		return a.nativeSystemStats()
+	}
 	if a.OsqueryInstance == nil {
-		return "", fmt.Errorf("osquery instance not initialized")
+		return nil, fmt.Errorf("osquery instance not initialized")
 	}
 
 	client, err := osquery.NewClient(a.OsquerySocketPath, 10*time.Second)
 	if err != nil {
-		return "", fmt.Errorf("failed to create osquery client: %w", err)
+		return nil, fmt.Errorf("failed to create osquery client: %w", err)
 	}
 	defer client.Close()
 
-	// Query CPU usage
-	cpuQuery := "SELECT cpu_time_user + cpu_time_system AS cpu_usage FROM cpu_time"
-	cpuResponse, err := client.Query(cpuQuery)
-	if err != nil {
-		return "", fmt.Errorf("failed to query CPU usage: %w", err)
-	}
-
-	cpuUsage := "Unknown"
-	if len(cpuResponse.Response) > 0 {
-		cpuUsage = cpuResponse.Response[0]["cpu_usage"]
-	}
+	systemStats := &SystemStats{}
 
-	memoryQuery := "SELECT (total_available_bytes * 100.0) / total_bytes AS memory_usage FROM memory_info"
-	memoryResponse, err := client.Query(memoryQuery)
+	systemStats.CPU, err = a.getCPUStats(client)
 	if err != nil {
-		return "", fmt.Errorf("failed to query memory usage: %w", err)
-	}
-
-	memoryUsage := "Unknown"
-	if len(memoryResponse.Response) > 0 {
-		memoryUsage = memoryResponse.Response[0]["memory_usage"]
+		return nil, err
 	}
 
-	diskQuery := fmt.Sprintf("SELECT (blocks_available * 100.0) / blocks_size AS disk_usage FROM mounts WHERE path = '%s'", a.MonitorDirectory)
-	diskResponse, err := client.Query(diskQuery)
+	systemStats.Memory, err = a.getMemoryStats(client)
 	if err != nil {
-		return "", fmt.Errorf("failed to query disk usage: %w", err)
+		return nil, err
 	}
 
-	diskUsage := "Unknown"
-	if len(diskResponse.Response) > 0 {
-		diskUsage = diskResponse.Response[0]["disk_usage"]
+	systemStats.Disk, err = a.getDiskStats(client)
+	if err != nil {
+		return nil, err
 	}
 
-	uptimeQuery := "SELECT total_seconds AS system_uptime FROM uptime"
+	uptimeQuery := osql.MustBuild("SELECT total_seconds AS system_uptime FROM uptime")
 	uptimeResponse, err := client.Query(uptimeQuery)
 	if err != nil {
-		return "", fmt.Errorf("failed to query system uptime: %w", err)
+		return nil, fmt.Errorf("failed to query system uptime: %w", err)
 	}
 
-	systemUptime := "Unknown"
 	if len(uptimeResponse.Response) > 0 {
-		systemUptime = uptimeResponse.Response[0]["system_uptime"]
+		if uptime, err := strconv.ParseUint(uptimeResponse.Response[0]["system_uptime"], 10, 64); err == nil {
+			systemStats.UptimeSeconds = &uptime
+		}
 	}
 
-	systemStats := SystemStats{
-		CPUUsage:     cpuUsage,
-		MemoryUsage:  memoryUsage,
-		DiskUsage:    diskUsage,
-		SystemUptime: systemUptime,
-	}
+	systemStats.summarize()
+	log.Println("Updated system stats")
+	return systemStats, nil
+}
 
-	jsonData, err := json.MarshalIndent(systemStats, "", "  ")
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal system stats to JSON: %w", err)
+// summarize fills the summary fields from the detailed sections.
+func (s *SystemStats) summarize() {
+	if s.CPU != nil {
+		s.CPUPercent = &s.CPU.Overall.UsagePercent
+	}
+	if s.Memory != nil {
+		s.MemoryUsedPercent = s.Memory.UsedPercent
+	}
+	if s.Disk != nil {
+		if monitored := s.Disk.Monitored(); monitored != nil {
+			s.DiskUsedPercent = &monitored.UsedPercent
+		}
 	}
-
-	log.Println("Updated system stats")
-	return string(jsonData), nil
 }
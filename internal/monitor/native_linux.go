@@ -0,0 +1,254 @@
+package monitor
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// procDir is where the native backend reads the kernel counters from.
+var procDir = "/proc"
+
+// The native backend turns /proc and statfs into rows shaped like the
+// osquery tables the default backend queries, so both share the parsing
+// and the delta math.
+
+func (a *Monitor) nativeSystemStats() (*SystemStats, error) {
+	systemStats := &SystemStats{}
+
+	cpuRows, err := readProcFile("stat", parseProcStat)
+	if err != nil {
+		return nil, err
+	}
+	loadRows, err := readProcFile("loadavg", parseProcLoadavg)
+	if err != nil {
+		return nil, err
+	}
+	systemStats.CPU = a.cpuStats(cpuRows, loadRows)
+
+	memoryRows, err := readProcFile("meminfo", parseProcMeminfo)
+	if err != nil {
+		return nil, err
+	}
+	systemStats.Memory = linuxMemoryStats(memoryRows[0])
+
+	mountRows, err := readProcFile("self/mounts", parseProcMounts)
+	if err != nil {
+		return nil, err
+	}
+	systemStats.Disk = a.diskStats(mountsFromRows(statfsRows(mountRows)))
+
+	uptimeRows, err := readProcFile("uptime", parseProcUptime)
+	if err != nil {
+		return nil, err
+	}
+	if uptime, err := strconv.ParseFloat(uptimeRows[0]["total_seconds"], 64); err == nil {
+		seconds := uint64(uptime)
+		systemStats.UptimeSeconds = &seconds
+	}
+
+	systemStats.summarize()
+	log.Println("Updated system stats")
+	return systemStats, nil
+}
+
+func nativeInterfaceRows() ([]map[string]string, error) {
+	return readProcFile("net/dev", parseProcNetDev)
+}
+
+func readProcFile(name string, parse func([]byte) ([]map[string]string, error)) ([]map[string]string, error) {
+	data, err := os.ReadFile(filepath.Join(procDir, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	rows, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return rows, nil
+}
+
+// parseProcStat returns a cpu_time row per core. The aggregate "cpu" line is
+// skipped, the same as in osquery.
+func parseProcStat(data []byte) ([]map[string]string, error) {
+	columns := []string{"user", "nice", "system", "idle", "iowait", "irq", "softirq", "steal"}
+
+	var rows []map[string]string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") || fields[0] == "cpu" {
+			continue
+		}
+		row := map[string]string{"core": strings.TrimPrefix(fields[0], "cpu")}
+		for i, column := range columns {
+			if i+1 < len(fields) {
+				row[column] = fields[i+1]
+			}
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no per core CPU lines")
+	}
+	return rows, nil
+}
+
+// parseProcLoadavg returns load_average rows.
+func parseProcLoadavg(data []byte) ([]map[string]string, error) {
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("unexpected format %q", data)
+	}
+	return []map[string]string{
+		{"period": "1m", "average": fields[0]},
+		{"period": "5m", "average": fields[1]},
+		{"period": "15m", "average": fields[2]},
+	}, nil
+}
+
+// parseProcMeminfo returns a single memory_info row, in bytes.
+func parseProcMeminfo(data []byte) ([]map[string]string, error) {
+	columns := map[string]string{
+		"MemTotal":     "memory_total",
+		"MemFree":      "memory_free",
+		"MemAvailable": "memory_available",
+		"Buffers":      "buffers",
+		"Cached":       "cached",
+		"SwapTotal":    "swap_total",
+		"SwapFree":     "swap_free",
+	}
+
+	row := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		column, wanted := columns[key]
+		if !ok || !wanted {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		n, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			n *= 1024
+		}
+		row[column] = strconv.FormatUint(n, 10)
+	}
+	if row["memory_total"] == "" {
+		return nil, fmt.Errorf("no MemTotal line")
+	}
+	return []map[string]string{row}, nil
+}
+
+// parseProcMounts returns the device, path and type of every mount. The
+// usage columns are filled in by statfsRows.
+func parseProcMounts(data []byte) ([]map[string]string, error) {
+	var rows []map[string]string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		rows = append(rows, map[string]string{
+			"device": unescapeMountField(fields[0]),
+			"path":   unescapeMountField(fields[1]),
+			"type":   fields[2],
+		})
+	}
+	return rows, nil
+}
+
+// unescapeMountField decodes the octal escapes the kernel uses for spaces,
+// tabs, newlines and backslashes in /proc/self/mounts.
+func unescapeMountField(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// statfsRows adds the mounts table usage columns. Mounts that cannot be
+// queried, usually for lack of permission, are left out.
+func statfsRows(rows []map[string]string) []map[string]string {
+	result := make([]map[string]string, 0, len(rows))
+	for _, r := range rows {
+		var fs syscall.Statfs_t
+		if err := syscall.Statfs(r["path"], &fs); err != nil {
+			continue
+		}
+		blockSize := uint64(fs.Frsize)
+		if blockSize == 0 {
+			blockSize = uint64(fs.Bsize)
+		}
+		r["blocks_size"] = strconv.FormatUint(blockSize, 10)
+		r["blocks"] = strconv.FormatUint(fs.Blocks, 10)
+		r["blocks_free"] = strconv.FormatUint(fs.Bfree, 10)
+		r["blocks_available"] = strconv.FormatUint(fs.Bavail, 10)
+		r["inodes"] = strconv.FormatUint(fs.Files, 10)
+		r["inodes_free"] = strconv.FormatUint(fs.Ffree, 10)
+		result = append(result, r)
+	}
+	return result
+}
+
+// parseProcUptime returns a single uptime row.
+func parseProcUptime(data []byte) ([]map[string]string, error) {
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("unexpected format %q", data)
+	}
+	return []map[string]string{{"total_seconds": fields[0]}}, nil
+}
+
+// parseProcNetDev returns an interface_details row per interface.
+func parseProcNetDev(data []byte) ([]map[string]string, error) {
+	// Receive columns come first, then transmit, eight of each.
+	columns := map[int]string{
+		0: "ibytes", 1: "ipackets", 2: "ierrors", 3: "idrops",
+		8: "obytes", 9: "opackets", 10: "oerrors", 11: "odrops",
+	}
+
+	var rows []map[string]string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		name, counters, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			// The two header lines.
+			continue
+		}
+		fields := strings.Fields(counters)
+		if len(fields) < 16 {
+			continue
+		}
+		row := map[string]string{"interface": strings.TrimSpace(name)}
+		for i, column := range columns {
+			row[column] = fields[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
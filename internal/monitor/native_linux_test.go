@@ -0,0 +1,77 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProcStat(t *testing.T) {
+	rows, err := parseProcStat([]byte(`cpu  100 0 50 800 10 0 5 0 0 0
+cpu0 60 0 30 400 5 0 3 0 0 0
+cpu1 40 0 20 400 5 0 2 0 0 0
+intr 12345
+ctxt 6789
+`))
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, "0", rows[0]["core"])
+	assert.Equal(t, "400", rows[1]["idle"])
+	assert.Equal(t, "2", rows[1]["softirq"])
+}
+
+func TestParseProcMeminfo(t *testing.T) {
+	rows, err := parseProcMeminfo([]byte(`MemTotal:       16000000 kB
+MemFree:         2000000 kB
+MemAvailable:    8000000 kB
+Buffers:          100000 kB
+Cached:          4000000 kB
+SwapCached:            0 kB
+SwapTotal:       2000000 kB
+SwapFree:        1500000 kB
+`))
+	require.NoError(t, err)
+	stats := linuxMemoryStats(rows[0])
+	assert.Equal(t, uint64(16000000*1024), stats.TotalBytes)
+	assert.Equal(t, uint64(8000000*1024), *stats.UsedBytes)
+	assert.Equal(t, uint64(500000*1024), *stats.SwapUsedBytes)
+	assert.Equal(t, 50.0, *stats.UsedPercent)
+}
+
+func TestParseProcNetDev(t *testing.T) {
+	rows, err := parseProcNetDev([]byte(`Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:    1000      10    0    0    0     0          0         0     1000      10    0    0    0     0       0          0
+  eth0: 5000000    4000    2    1    0     0          0         0  3000000    2500    0    3    0     0       0          0
+`))
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, "eth0", rows[1]["interface"])
+	assert.Equal(t, "5000000", rows[1]["ibytes"])
+	assert.Equal(t, "2", rows[1]["ierrors"])
+	assert.Equal(t, "3000000", rows[1]["obytes"])
+	assert.Equal(t, "3", rows[1]["odrops"])
+}
+
+func TestUnescapeMountField(t *testing.T) {
+	assert.Equal(t, "/mnt/my disk", unescapeMountField(`/mnt/my\040disk`))
+	assert.Equal(t, "/plain", unescapeMountField("/plain"))
+}
+
+func TestNativeSystemStats(t *testing.T) {
+	m := &Monitor{MonitorDirectory: t.TempDir(), Native: true}
+
+	first, err := m.GetSystemMonitoringData()
+	require.NoError(t, err)
+	assert.Nil(t, first.CPU, "no CPU delta on the first sample")
+	require.NotNil(t, first.Memory)
+	assert.NotZero(t, first.Memory.TotalBytes)
+
+	// /proc/stat counts in 1/100 s ticks.
+	time.Sleep(200 * time.Millisecond)
+	second, err := m.GetSystemMonitoringData()
+	require.NoError(t, err)
+	assert.NotNil(t, second.CPU)
+}
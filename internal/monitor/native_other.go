@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package monitor
+
+import "fmt"
+
+var errNativeUnsupported = fmt.Errorf("native backend is only available on Linux")
+
+func (a *Monitor) nativeSystemStats() (*SystemStats, error) {
+	return nil, errNativeUnsupported
+}
+
+func nativeInterfaceRows() ([]map[string]string, error) {
+	return nil, errNativeUnsupported
+}
+
+func nativeHostInventory() (*HostInventory, error) {
+	return nil, errNativeUnsupported
+}
@@ -0,0 +1,150 @@
+package monitor
+
+import (
+	"daemon/internal/osql"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/osquery/osquery-go"
+)
+
+// Network reports per interface traffic counters from interface_details.
+// Rates are computed against the previous call, so keep one Network around
+// for the lifetime of the collection loop.
+type Network struct {
+	OsqueryInstance   *osquery.ExtensionManagerServer
+	OsquerySocketPath string
+	// IncludeInterfaces and ExcludeInterfaces are path.Match patterns such
+	// as "eth*". An empty include list matches every interface.
+	IncludeInterfaces []string
+	ExcludeInterfaces []string
+	// Native reads /proc/net/dev instead of querying osquery. It is only
+	// available on Linux.
+	Native bool
+
+	prev     map[string]InterfaceStats
+	prevTime time.Time
+}
+
+type InterfaceStats struct {
+	Interface        string   `json:"interface"`
+	BytesIn          uint64   `json:"bytes_in"`
+	BytesOut         uint64   `json:"bytes_out"`
+	PacketsIn        uint64   `json:"packets_in"`
+	PacketsOut       uint64   `json:"packets_out"`
+	ErrorsIn         uint64   `json:"errors_in"`
+	ErrorsOut        uint64   `json:"errors_out"`
+	DropsIn          uint64   `json:"drops_in"`
+	DropsOut         uint64   `json:"drops_out"`
+	BytesInPerSec    *float64 `json:"bytes_in_per_sec"`
+	BytesOutPerSec   *float64 `json:"bytes_out_per_sec"`
+	PacketsInPerSec  *float64 `json:"packets_in_per_sec"`
+	PacketsOutPerSec *float64 `json:"packets_out_per_sec"`
+	ErrorsPerSec     *float64 `json:"errors_per_sec"`
+	DropsPerSec      *float64 `json:"drops_per_sec"`
+}
+
+type NetworkStats struct {
+	Interfaces []InterfaceStats `json:"interfaces"`
+}
+
+func (a *Network) GetNetworkStats() (*NetworkStats, error) {
+	if a.Native {
+		rows, err := nativeInterfaceRows()
+		if err != nil {
+			return nil, err
+		}
+		return a.networkStats(rows, time.Now()), nil
+	}
+	if a.OsqueryInstance == nil {
+		return nil, fmt.Errorf("osquery instance not initialized")
+	}
+
+	client, err := osquery.NewClient(a.OsquerySocketPath, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create osquery client: %w", err)
+	}
+	defer client.Close()
+
+	response, err := client.Query(osql.MustBuild("SELECT interface, ibytes, obytes, ipackets, opackets, ierrors, oerrors, idrops, odrops FROM interface_details"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query interface details: %w", err)
+	}
+
+	stats := a.networkStats(response.Response, time.Now())
+
+	log.Println("Updated network stats")
+	return stats, nil
+}
+
+func (a *Network) networkStats(rows []map[string]string, now time.Time) *NetworkStats {
+	elapsed := now.Sub(a.prevTime).Seconds()
+	curr := make(map[string]InterfaceStats, len(rows))
+	stats := &NetworkStats{Interfaces: []InterfaceStats{}}
+
+	for _, r := range rows {
+		name := r["interface"]
+		if !a.matchInterface(name) {
+			continue
+		}
+		s := InterfaceStats{
+			Interface:  name,
+			BytesIn:    parseUint(r["ibytes"]),
+			BytesOut:   parseUint(r["obytes"]),
+			PacketsIn:  parseUint(r["ipackets"]),
+			PacketsOut: parseUint(r["opackets"]),
+			ErrorsIn:   parseUint(r["ierrors"]),
+			ErrorsOut:  parseUint(r["oerrors"]),
+			DropsIn:    parseUint(r["idrops"]),
+			DropsOut:   parseUint(r["odrops"]),
+		}
+		curr[name] = s
+
+		if prev, ok := a.prev[name]; ok && elapsed > 0 {
+			s.BytesInPerSec = rate(prev.BytesIn, s.BytesIn, elapsed)
+			s.BytesOutPerSec = rate(prev.BytesOut, s.BytesOut, elapsed)
+			s.PacketsInPerSec = rate(prev.PacketsIn, s.PacketsIn, elapsed)
+			s.PacketsOutPerSec = rate(prev.PacketsOut, s.PacketsOut, elapsed)
+			s.ErrorsPerSec = rate(prev.ErrorsIn+prev.ErrorsOut, s.ErrorsIn+s.ErrorsOut, elapsed)
+			s.DropsPerSec = rate(prev.DropsIn+prev.DropsOut, s.DropsIn+s.DropsOut, elapsed)
+		}
+		stats.Interfaces = append(stats.Interfaces, s)
+	}
+
+	sort.Slice(stats.Interfaces, func(i, j int) bool {
+		return stats.Interfaces[i].Interface < stats.Interfaces[j].Interface
+	})
+	a.prev = curr
+	a.prevTime = now
+	return stats
+}
+
+func (a *Network) matchInterface(name string) bool {
+	for _, pattern := range a.ExcludeInterfaces {
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
+	}
+	if len(a.IncludeInterfaces) == 0 {
+		return true
+	}
+	for _, pattern := range a.IncludeInterfaces {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// rate returns nil when the counter went backwards, which happens when an
+// interface is recreated or the counter wraps.
+func rate(prev, curr uint64, seconds float64) *float64 {
+	if curr < prev {
+		return nil
+	}
+	r := round2(float64(curr-prev) / seconds)
+	return &r
+}
@@ -0,0 +1,97 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func interfaceRow(name string, ibytes, obytes, ierrors string) map[string]string {
+	return map[string]string{
+		"interface": name,
+		"ibytes":    ibytes,
+		"obytes":    obytes,
+		"ipackets":  "10",
+		"opackets":  "10",
+		"ierrors":   ierrors,
+		"oerrors":   "0",
+		"idrops":    "0",
+		"odrops":    "0",
+	}
+}
+
+func TestNetworkStatsRates(t *testing.T) {
+	network := &Network{}
+	start := time.Now()
+
+	// The first tick has counters but no rates.
+	stats := network.networkStats([]map[string]string{
+		interfaceRow("eth0", "1000", "500", "1"),
+		interfaceRow("en0", "0", "0", "0"),
+	}, start)
+	require.Len(t, stats.Interfaces, 2)
+	assert.Equal(t, "en0", stats.Interfaces[0].Interface)
+	eth0 := stats.Interfaces[1]
+	assert.Equal(t, uint64(1000), eth0.BytesIn)
+	assert.Nil(t, eth0.BytesInPerSec)
+	assert.Nil(t, eth0.ErrorsPerSec)
+
+	stats = network.networkStats([]map[string]string{
+		interfaceRow("eth0", "3000", "1500", "5"),
+		interfaceRow("en0", "0", "0", "0"),
+		// New interfaces start without rates.
+		interfaceRow("wg0", "100", "100", "0"),
+	}, start.Add(2*time.Second))
+	require.Len(t, stats.Interfaces, 3)
+	eth0 = stats.Interfaces[1]
+	require.NotNil(t, eth0.BytesInPerSec)
+	assert.Equal(t, 1000.0, *eth0.BytesInPerSec)
+	assert.Equal(t, 500.0, *eth0.BytesOutPerSec)
+	assert.Equal(t, 2.0, *eth0.ErrorsPerSec)
+	assert.Equal(t, 0.0, *eth0.PacketsInPerSec)
+	assert.Nil(t, stats.Interfaces[2].BytesInPerSec)
+
+	// A counter that went backwards, after a reset or a wrap, has no rate.
+	stats = network.networkStats([]map[string]string{
+		interfaceRow("eth0", "10", "2500", "5"),
+	}, start.Add(3*time.Second))
+	require.Len(t, stats.Interfaces, 1)
+	assert.Nil(t, stats.Interfaces[0].BytesInPerSec)
+	assert.Equal(t, 1000.0, *stats.Interfaces[0].BytesOutPerSec)
+}
+
+func TestRate(t *testing.T) {
+	assert.Equal(t, 50.0, *rate(100, 200, 2))
+	assert.Equal(t, 0.0, *rate(100, 100, 1))
+	assert.Nil(t, rate(200, 100, 1))
+	assert.Nil(t, rate(^uint64(0)-10, 5, 1))
+}
+
+func TestMatchInterface(t *testing.T) {
+	all := &Network{}
+	assert.True(t, all.matchInterface("lo"))
+
+	network := &Network{
+		IncludeInterfaces: []string{"eth*", "en*", "veth9"},
+		ExcludeInterfaces: []string{"veth*", "en1"},
+	}
+	for name, want := range map[string]bool{
+		"eth0":  true,
+		"en0":   true,
+		"en1":   false,
+		"lo":    false,
+		"veth9": false,
+		"wg0":   false,
+	} {
+		assert.Equal(t, want, network.matchInterface(name), name)
+	}
+
+	filtered := (&Network{ExcludeInterfaces: []string{"lo*"}}).networkStats([]map[string]string{
+		interfaceRow("lo0", "1", "1", "0"),
+		interfaceRow("eth0", "1", "1", "0"),
+	}, time.Now())
+	require.Len(t, filtered.Interfaces, 1)
+	assert.Equal(t, "eth0", filtered.Interfaces[0].Interface)
+}
@@ -0,0 +1,136 @@
+package monitor
+
+import (
+	"daemon/internal/osql"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/osquery/osquery-go"
+)
+
+// Processes reports the heaviest processes by CPU and by resident memory.
+// CPU percentages are computed against the previous call, so keep one
+// Processes around for the lifetime of the collection loop.
+type Processes struct {
+	OsqueryInstance   *osquery.ExtensionManagerServer
+	OsquerySocketPath string
+	// TopN is how many processes to keep in each list. Defaults to 10.
+	TopN int
+
+	prev     map[processKey]uint64
+	prevTime time.Time
+}
+
+type ProcessInfo struct {
+	PID           int64      `json:"pid"`
+	Name          string     `json:"name"`
+	Path          string     `json:"path"`
+	User          string     `json:"user"`
+	StartTime     *time.Time `json:"start_time"`
+	CPUPercent    *float64   `json:"cpu_percent"`
+	ResidentBytes uint64     `json:"resident_bytes"`
+}
+
+type ProcessStats struct {
+	TopCPU    []ProcessInfo `json:"top_cpu"`
+	TopMemory []ProcessInfo `json:"top_memory"`
+}
+
+// processKey includes the start time so a recycled pid does not inherit the
+// CPU time of the process it replaced.
+type processKey struct {
+	pid       int64
+	startTime string
+}
+
+func (a *Processes) GetProcessStats() (*ProcessStats, error) {
+	if a.OsqueryInstance == nil {
+		return nil, fmt.Errorf("osquery instance not initialized")
+	}
+
+	client, err := osquery.NewClient(a.OsquerySocketPath, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create osquery client: %w", err)
+	}
+	defer client.Close()
+
+	query := osql.MustBuild("SELECT p.pid, p.name, p.path, p.start_time, p.user_time, p.system_time, p.resident_size, u.username " +
+		"FROM processes p LEFT JOIN users u ON p.uid = u.uid")
+	response, err := client.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query processes: %w", err)
+	}
+
+	stats := a.processStats(response.Response, time.Now())
+
+	log.Println("Updated process stats")
+	return stats, nil
+}
+
+func (a *Processes) processStats(rows []map[string]string, now time.Time) *ProcessStats {
+	topN := a.TopN
+	if topN <= 0 {
+		topN = 10
+	}
+	elapsedMs := float64(now.Sub(a.prevTime).Milliseconds())
+
+	curr := make(map[processKey]uint64, len(rows))
+	processes := make([]ProcessInfo, 0, len(rows))
+	for _, r := range rows {
+		p := ProcessInfo{
+			PID:           int64(parseUint(r["pid"])),
+			Name:          r["name"],
+			Path:          r["path"],
+			User:          r["username"],
+			StartTime:     unixTime(r["start_time"]),
+			ResidentBytes: parseUint(r["resident_size"]),
+		}
+		key := processKey{pid: p.PID, startTime: r["start_time"]}
+		// user_time and system_time are milliseconds of CPU time.
+		cpuMs := parseUint(r["user_time"]) + parseUint(r["system_time"])
+		curr[key] = cpuMs
+
+		if before, ok := a.prev[key]; ok && elapsedMs > 0 && cpuMs >= before {
+			// Like top, a process busy on several cores can exceed 100%.
+			pct := round2(float64(cpuMs-before) * 100 / elapsedMs)
+			p.CPUPercent = &pct
+		}
+		processes = append(processes, p)
+	}
+	a.prev = curr
+	a.prevTime = now
+
+	byCPU := make([]ProcessInfo, len(processes))
+	copy(byCPU, processes)
+	sort.SliceStable(byCPU, func(i, j int) bool {
+		return cpuOf(byCPU[i]) > cpuOf(byCPU[j])
+	})
+
+	byMemory := processes
+	sort.SliceStable(byMemory, func(i, j int) bool {
+		return byMemory[i].ResidentBytes > byMemory[j].ResidentBytes
+	})
+
+	return &ProcessStats{
+		TopCPU:    byCPU[:min(topN, len(byCPU))],
+		TopMemory: byMemory[:min(topN, len(byMemory))],
+	}
+}
+
+func cpuOf(p ProcessInfo) float64 {
+	if p.CPUPercent == nil {
+		return -1
+	}
+	return *p.CPUPercent
+}
+
+func unixTime(s string) *time.Time {
+	secs := parseUint(s)
+	if secs == 0 {
+		return nil
+	}
+	t := time.Unix(int64(secs), 0).UTC()
+	return &t
+}
@@ -0,0 +1,113 @@
+package monitor
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func processRow(pid, name, start, userMs, systemMs, resident string) map[string]string {
+	return map[string]string{
+		"pid":           pid,
+		"name":          name,
+		"path":          "/usr/bin/" + name,
+		"username":      "root",
+		"start_time":    start,
+		"user_time":     userMs,
+		"system_time":   systemMs,
+		"resident_size": resident,
+	}
+}
+
+func pids(processes []ProcessInfo) []int64 {
+	var pids []int64
+	for _, p := range processes {
+		pids = append(pids, p.PID)
+	}
+	return pids
+}
+
+func TestProcessStatsCPUBetweenTicks(t *testing.T) {
+	processes := &Processes{}
+	start := time.Now()
+
+	// The first tick has no CPU percentages yet.
+	stats := processes.processStats([]map[string]string{
+		processRow("1", "init", "1000", "100", "100", "10"),
+		processRow("2", "busy", "1000", "1000", "0", "20"),
+	}, start)
+	require.Len(t, stats.TopCPU, 2)
+	for _, p := range stats.TopCPU {
+		assert.Nil(t, p.CPUPercent, p.Name)
+	}
+	assert.Equal(t, int64(1000), stats.TopCPU[0].StartTime.Unix())
+
+	stats = processes.processStats([]map[string]string{
+		processRow("1", "init", "1000", "150", "150", "10"),
+		// 3000 ms of CPU in 2000 ms: busy on more than one core.
+		processRow("2", "busy", "1000", "3500", "500", "20"),
+	}, start.Add(2*time.Second))
+	assert.Equal(t, []int64{2, 1}, pids(stats.TopCPU))
+	assert.Equal(t, 150.0, *stats.TopCPU[0].CPUPercent)
+	assert.Equal(t, 5.0, *stats.TopCPU[1].CPUPercent)
+}
+
+func TestProcessStatsPIDReuse(t *testing.T) {
+	processes := &Processes{}
+	start := time.Now()
+	processes.processStats([]map[string]string{
+		processRow("42", "old", "1000", "5000", "0", "10"),
+	}, start)
+
+	// Same pid, another start time: a new process, not a negative delta or
+	// the CPU time of the one it replaced.
+	stats := processes.processStats([]map[string]string{
+		processRow("42", "new", "2000", "100", "0", "10"),
+	}, start.Add(time.Second))
+	require.Len(t, stats.TopCPU, 1)
+	assert.Equal(t, "new", stats.TopCPU[0].Name)
+	assert.Nil(t, stats.TopCPU[0].CPUPercent)
+
+	stats = processes.processStats([]map[string]string{
+		processRow("42", "new", "2000", "600", "0", "10"),
+	}, start.Add(2*time.Second))
+	assert.Equal(t, 50.0, *stats.TopCPU[0].CPUPercent)
+}
+
+func TestProcessStatsTopN(t *testing.T) {
+	processes := &Processes{TopN: 2}
+	start := time.Now()
+	rows := func(cpu ...string) []map[string]string {
+		return []map[string]string{
+			processRow("1", "a", "1000", cpu[0], "0", "300"),
+			processRow("2", "b", "1000", cpu[1], "0", "100"),
+			processRow("3", "c", "1000", cpu[2], "0", "200"),
+			processRow("4", "d", "1000", cpu[3], "0", "400"),
+		}
+	}
+	processes.processStats(rows("0", "0", "0", "0"), start)
+	stats := processes.processStats(rows("100", "300", "200", "0"), start.Add(time.Second))
+
+	assert.Equal(t, []int64{2, 3}, pids(stats.TopCPU))
+	assert.Equal(t, []int64{4, 1}, pids(stats.TopMemory))
+
+	// Processes without a percentage sort after those with one.
+	stats = processes.processStats(append(rows("100", "300", "200", "0"),
+		processRow("5", "e", "1000", "0", "0", "1")), start.Add(2*time.Second))
+	assert.Len(t, stats.TopCPU, 2)
+	assert.NotContains(t, pids(stats.TopCPU), int64(5))
+	assert.Equal(t, -1.0, cpuOf(ProcessInfo{}))
+}
+
+func TestProcessStatsDefaultTopN(t *testing.T) {
+	var rows []map[string]string
+	for i := 1; i <= 15; i++ {
+		rows = append(rows, processRow(strconv.Itoa(i), "p", "1000", "0", "0", "1"))
+	}
+	stats := (&Processes{}).processStats(rows, time.Now())
+	assert.Len(t, stats.TopCPU, 10)
+	assert.Len(t, stats.TopMemory, 10)
+}
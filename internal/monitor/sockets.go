@@ -0,0 +1,222 @@
+package monitor
+
+import (
+	"daemon/internal/osql"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/osquery/osquery-go"
+)
+
+// Sockets inventories listening ports and established connections with the
+// process that owns them. Listeners that appear or disappear between two
+// calls are reported as events, so keep one Sockets around for the lifetime
+// of the collection loop.
+type Sockets struct {
+	OsqueryInstance   *osquery.ExtensionManagerServer
+	OsquerySocketPath string
+	Logger            *log.Logger
+
+	prev   map[listenerKey]Listener
+	primed bool
+}
+
+type Listener struct {
+	PID      int64  `json:"pid"`
+	Process  string `json:"process"`
+	Path     string `json:"path"`
+	Protocol string `json:"protocol"`
+	Family   string `json:"family"`
+	Address  string `json:"address"`
+	Port     int    `json:"port"`
+}
+
+type Connection struct {
+	PID           int64  `json:"pid"`
+	Process       string `json:"process"`
+	Path          string `json:"path"`
+	Protocol      string `json:"protocol"`
+	LocalAddress  string `json:"local_address"`
+	LocalPort     int    `json:"local_port"`
+	RemoteAddress string `json:"remote_address"`
+	RemotePort    int    `json:"remote_port"`
+	State         string `json:"state"`
+}
+
+const (
+	ListenerOpened = "listener_opened"
+	ListenerClosed = "listener_closed"
+)
+
+type SocketEvent struct {
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	Listener Listener  `json:"listener"`
+}
+
+type SocketStats struct {
+	Listeners   []Listener    `json:"listeners"`
+	Connections []Connection  `json:"connections"`
+	Events      []SocketEvent `json:"events"`
+}
+
+type listenerKey struct {
+	pid      int64
+	protocol string
+	address  string
+	port     int
+}
+
+func (a *Sockets) GetSocketStats() (*SocketStats, error) {
+	if a.OsqueryInstance == nil {
+		return nil, fmt.Errorf("osquery instance not initialized")
+	}
+
+	client, err := osquery.NewClient(a.OsquerySocketPath, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create osquery client: %w", err)
+	}
+	defer client.Close()
+
+	listenerQuery := osql.MustBuild("SELECT l.pid, l.port, l.protocol, l.family, l.address, p.name, p.path " +
+		"FROM listening_ports l LEFT JOIN processes p ON l.pid = p.pid WHERE l.port != 0")
+	listenerResponse, err := client.Query(listenerQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query listening ports: %w", err)
+	}
+
+	connectionQuery := osql.MustBuild("SELECT s.pid, s.protocol, s.local_address, s.local_port, s.remote_address, s.remote_port, s.state, p.name, p.path " +
+		"FROM process_open_sockets s LEFT JOIN processes p ON s.pid = p.pid WHERE s.remote_port != 0")
+	connectionResponse, err := client.Query(connectionQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query open sockets: %w", err)
+	}
+
+	stats := &SocketStats{
+		Listeners:   parseListeners(listenerResponse.Response),
+		Connections: parseConnections(connectionResponse.Response),
+	}
+	stats.Events = a.diffListeners(stats.Listeners, time.Now())
+	for _, e := range stats.Events {
+		a.logf("Socket event %s: %s %s:%d (pid %d, %s)", e.Type, e.Listener.Protocol, e.Listener.Address, e.Listener.Port, e.Listener.PID, e.Listener.Process)
+	}
+
+	log.Println("Updated socket stats")
+	return stats, nil
+}
+
+// diffListeners reports listeners opened or closed since the previous call.
+// The first call only records a baseline.
+func (a *Sockets) diffListeners(listeners []Listener, now time.Time) []SocketEvent {
+	curr := make(map[listenerKey]Listener, len(listeners))
+	for _, l := range listeners {
+		curr[listenerKey{pid: l.PID, protocol: l.Protocol, address: l.Address, port: l.Port}] = l
+	}
+
+	events := []SocketEvent{}
+	if a.primed {
+		timestamp := now.UTC()
+		for key, l := range curr {
+			if _, ok := a.prev[key]; !ok {
+				events = append(events, SocketEvent{Type: ListenerOpened, Time: timestamp, Listener: l})
+			}
+		}
+		for key, l := range a.prev {
+			if _, ok := curr[key]; !ok {
+				events = append(events, SocketEvent{Type: ListenerClosed, Time: timestamp, Listener: l})
+			}
+		}
+		sort.Slice(events, func(i, j int) bool {
+			if events[i].Listener.Port != events[j].Listener.Port {
+				return events[i].Listener.Port < events[j].Listener.Port
+			}
+			return events[i].Type < events[j].Type
+		})
+	}
+
+	a.prev = curr
+	a.primed = true
+	return events
+}
+
+func parseListeners(rows []map[string]string) []Listener {
+	listeners := make([]Listener, 0, len(rows))
+	for _, r := range rows {
+		listeners = append(listeners, Listener{
+			PID:      parseInt(r["pid"]),
+			Process:  r["name"],
+			Path:     r["path"],
+			Protocol: protocolName(r["protocol"]),
+			Family:   familyName(r["family"]),
+			Address:  r["address"],
+			Port:     int(parseInt(r["port"])),
+		})
+	}
+	sort.Slice(listeners, func(i, j int) bool {
+		if listeners[i].Port != listeners[j].Port {
+			return listeners[i].Port < listeners[j].Port
+		}
+		return listeners[i].Address < listeners[j].Address
+	})
+	return listeners
+}
+
+func parseConnections(rows []map[string]string) []Connection {
+	connections := make([]Connection, 0, len(rows))
+	for _, r := range rows {
+		connections = append(connections, Connection{
+			PID:           parseInt(r["pid"]),
+			Process:       r["name"],
+			Path:          r["path"],
+			Protocol:      protocolName(r["protocol"]),
+			LocalAddress:  r["local_address"],
+			LocalPort:     int(parseInt(r["local_port"])),
+			RemoteAddress: r["remote_address"],
+			RemotePort:    int(parseInt(r["remote_port"])),
+			State:         r["state"],
+		})
+	}
+	return connections
+}
+
+func protocolName(p string) string {
+	switch p {
+	case "6":
+		return "tcp"
+	case "17":
+		return "udp"
+	default:
+		return p
+	}
+}
+
+// familyName maps AF_INET and the per platform values of AF_INET6.
+func familyName(f string) string {
+	switch f {
+	case "2":
+		return "ipv4"
+	case "10", "23", "30":
+		return "ipv6"
+	default:
+		return f
+	}
+}
+
+func parseInt(s string) int64 {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+func (a *Sockets) logf(format string, args ...interface{}) {
+	if a.Logger != nil {
+		a.Logger.Printf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
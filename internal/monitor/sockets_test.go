@@ -0,0 +1,77 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffListeners(t *testing.T) {
+	ssh := Listener{PID: 10, Process: "sshd", Protocol: "tcp", Family: "ipv4", Address: "0.0.0.0", Port: 22}
+	web := Listener{PID: 20, Process: "nginx", Protocol: "tcp", Family: "ipv4", Address: "0.0.0.0", Port: 80}
+	webRestarted := web
+	webRestarted.PID = 21
+	dns := Listener{PID: 30, Process: "dnsmasq", Protocol: "udp", Family: "ipv6", Address: "::", Port: 53}
+
+	type event struct {
+		Type string
+		PID  int64
+		Port int
+	}
+	sockets := &Sockets{}
+	now := time.Now()
+	for _, tc := range []struct {
+		name      string
+		listeners []Listener
+		want      []event
+	}{
+		{"first snapshot is a baseline", []Listener{ssh, web}, []event{}},
+		{"unchanged", []Listener{web, ssh}, []event{}},
+		{"opened", []Listener{ssh, web, dns}, []event{{ListenerOpened, 30, 53}}},
+		{"closed", []Listener{ssh, web}, []event{{ListenerClosed, 30, 53}}},
+		{"pid change on the same port", []Listener{ssh, webRestarted}, []event{
+			{ListenerClosed, 20, 80},
+			{ListenerOpened, 21, 80},
+		}},
+		{"everything closed", nil, []event{
+			{ListenerClosed, 10, 22},
+			{ListenerClosed, 21, 80},
+		}},
+	} {
+		events := sockets.diffListeners(tc.listeners, now)
+		got := []event{}
+		for _, e := range events {
+			got = append(got, event{e.Type, e.Listener.PID, e.Listener.Port})
+			assert.Equal(t, now.UTC(), e.Time, tc.name)
+		}
+		assert.Equal(t, tc.want, got, tc.name)
+	}
+}
+
+func TestParseListeners(t *testing.T) {
+	listeners := parseListeners([]map[string]string{
+		{"pid": "30", "name": "dnsmasq", "path": "/usr/sbin/dnsmasq", "protocol": "17", "family": "10", "address": "::", "port": "53"},
+		{"pid": "10", "name": "sshd", "path": "/usr/sbin/sshd", "protocol": "6", "family": "2", "address": "0.0.0.0", "port": "22"},
+		{"pid": "11", "name": "sshd", "protocol": "6", "family": "30", "address": "::", "port": "22"},
+		{"pid": "x", "name": "odd", "protocol": "132", "family": "1", "address": "/tmp/sock", "port": "9"},
+	})
+
+	// Sorted by port, then address.
+	assert.Equal(t, []Listener{
+		// Unknown protocols and families are passed through.
+		{PID: 0, Process: "odd", Protocol: "132", Family: "1", Address: "/tmp/sock", Port: 9},
+		{PID: 10, Process: "sshd", Path: "/usr/sbin/sshd", Protocol: "tcp", Family: "ipv4", Address: "0.0.0.0", Port: 22},
+		{PID: 11, Process: "sshd", Protocol: "tcp", Family: "ipv6", Address: "::", Port: 22},
+		{PID: 30, Process: "dnsmasq", Path: "/usr/sbin/dnsmasq", Protocol: "udp", Family: "ipv6", Address: "::", Port: 53},
+	}, listeners)
+}
+
+func TestProtocolAndFamilyNames(t *testing.T) {
+	for in, want := range map[string]string{"6": "tcp", "17": "udp", "132": "132"} {
+		assert.Equal(t, want, protocolName(in))
+	}
+	for in, want := range map[string]string{"2": "ipv4", "10": "ipv6", "23": "ipv6", "30": "ipv6", "1": "1"} {
+		assert.Equal(t, want, familyName(in))
+	}
+}
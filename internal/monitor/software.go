@@ -0,0 +1,299 @@
+package monitor
+
+import (
+	"daemon/internal/osql"
+	"daemon/internal/state"
+	"fmt"
+	"log"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/osquery/osquery-go"
+)
+
+// Software inventories installed packages and reports what was installed,
+// uninstalled or upgraded since the last committed snapshot. Each call
+// leaves its snapshot pending until Commit, which is called once the events
+// were delivered, so that undelivered events are reported again. The
+// committed snapshot is kept in Store, when set, so that changes made while
+// the daemon was down are reported after a restart. Without a saved
+// snapshot the first call only records a baseline.
+type Software struct {
+	OsqueryInstance   *osquery.ExtensionManagerServer
+	OsquerySocketPath string
+	Store             *state.Store
+
+	mutex   sync.Mutex
+	prev    map[string][]string
+	primed  bool
+	pending map[string][]string
+}
+
+type Package struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Vendor  string `json:"vendor"`
+	// Source is the osquery table the package was found in, such as deb,
+	// rpm, apps, homebrew or programs.
+	Source      string     `json:"source"`
+	InstallDate *time.Time `json:"install_date"`
+}
+
+const (
+	SoftwareInstalled   = "installed"
+	SoftwareUninstalled = "uninstalled"
+	// SoftwareUpgraded is any version change, downgrades included.
+	SoftwareUpgraded = "upgraded"
+)
+
+type SoftwareEvent struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Package Package   `json:"package"`
+	// PreviousVersion is set for upgrades.
+	PreviousVersion string `json:"previous_version,omitempty"`
+}
+
+type SoftwareStats struct {
+	Packages []Package       `json:"packages"`
+	Events   []SoftwareEvent `json:"events"`
+}
+
+const softwareStateName = "software/packages"
+
+// softwareQuery reads one package table into the common columns.
+type softwareQuery struct {
+	source string
+	sql    string
+}
+
+func softwareQueries() []softwareQuery {
+	switch runtime.GOOS {
+	case "darwin":
+		return []softwareQuery{
+			{"apps", osql.MustBuild("SELECT name, bundle_short_version AS version, bundle_identifier AS vendor, '' AS install_date FROM apps")},
+			{"homebrew", osql.MustBuild("SELECT name, version, '' AS vendor, '' AS install_date FROM homebrew_packages")},
+		}
+	case "windows":
+		return []softwareQuery{
+			{"programs", osql.MustBuild("SELECT name, version, publisher AS vendor, install_date FROM programs")},
+		}
+	default:
+		return []softwareQuery{
+			{"deb", osql.MustBuild("SELECT name, version, maintainer AS vendor, '' AS install_date FROM deb_packages WHERE status = 'install ok installed'")},
+			{"rpm", osql.MustBuild("SELECT name, CASE WHEN release = '' THEN version ELSE version || '-' || release END AS version, vendor, install_time AS install_date FROM rpm_packages")},
+		}
+	}
+}
+
+func (a *Software) GetSoftwareStats() (*SoftwareStats, error) {
+	if a.OsqueryInstance == nil {
+		return nil, fmt.Errorf("osquery instance not initialized")
+	}
+
+	client, err := osquery.NewClient(a.OsquerySocketPath, 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create osquery client: %w", err)
+	}
+	defer client.Close()
+
+	// A host usually has only one of the package managers, and osquery
+	// builds without a table fail the query, so only give up if all fail.
+	packages := []Package{}
+	failed := map[string]bool{}
+	var lastErr error
+	succeeded := 0
+	for _, q := range softwareQueries() {
+		response, err := client.Query(q.sql)
+		if err == nil && response.GetStatus() != nil && response.GetStatus().Code != 0 {
+			err = fmt.Errorf("%s", response.GetStatus().Message)
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("failed to query %s packages: %w", q.source, err)
+			failed[q.source] = true
+			continue
+		}
+		succeeded++
+		packages = append(packages, parsePackages(q.source, response.Response)...)
+	}
+	if succeeded == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	sort.Slice(packages, func(i, j int) bool {
+		if packages[i].Name != packages[j].Name {
+			return packages[i].Name < packages[j].Name
+		}
+		return packages[i].Source < packages[j].Source
+	})
+
+	events, err := a.diffPackages(packages, failed, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	log.Println("Updated software inventory")
+	return &SoftwareStats{Packages: packages, Events: events}, nil
+}
+
+func parsePackages(source string, rows []map[string]string) []Package {
+	packages := make([]Package, 0, len(rows))
+	for _, r := range rows {
+		if r["name"] == "" {
+			continue
+		}
+		packages = append(packages, Package{
+			Name:        r["name"],
+			Version:     r["version"],
+			Vendor:      strings.TrimSpace(r["vendor"]),
+			Source:      source,
+			InstallDate: parseInstallDate(r["install_date"]),
+		})
+	}
+	return packages
+}
+
+// parseInstallDate accepts a unix timestamp (rpm) or YYYYMMDD (Windows
+// programs).
+func parseInstallDate(s string) *time.Time {
+	if s == "" || s == "0" {
+		return nil
+	}
+	if len(s) == 8 {
+		if t, err := time.Parse("20060102", s); err == nil {
+			return &t
+		}
+	}
+	if seconds, err := strconv.ParseInt(s, 10, 64); err == nil && seconds > 0 {
+		t := time.Unix(seconds, 0).UTC()
+		return &t
+	}
+	return nil
+}
+
+func packageKey(p Package) string {
+	return p.Source + "/" + p.Name
+}
+
+// diffPackages compares the installed versions of every package with the
+// previous snapshot. Several versions of one package can be installed side
+// by side, kernels for example, so a single version replaced by another is
+// an upgrade and anything else is installs and uninstalls. The packages of
+// the failed sources are unknown this time, so their previous entries are
+// carried over rather than reported as uninstalled.
+func (a *Software) diffPackages(packages []Package, failed map[string]bool, now time.Time) ([]SoftwareEvent, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	curr := map[string][]string{}
+	byVersion := map[string]Package{}
+	for _, p := range packages {
+		key := packageKey(p)
+		curr[key] = append(curr[key], p.Version)
+		byVersion[key+"@"+p.Version] = p
+	}
+
+	if !a.primed && a.Store != nil {
+		found, err := a.Store.Load(softwareStateName, &a.prev)
+		if err != nil {
+			return nil, err
+		}
+		a.primed = found
+	}
+
+	for key, versions := range a.prev {
+		source, _, _ := strings.Cut(key, "/")
+		if failed[source] {
+			curr[key] = versions
+		}
+	}
+
+	events := []SoftwareEvent{}
+	if a.primed {
+		timestamp := now.UTC()
+		for key, versions := range curr {
+			added, removed := diffVersions(a.prev[key], versions)
+			if len(added) == 1 && len(removed) == 1 {
+				events = append(events, SoftwareEvent{
+					Type:            SoftwareUpgraded,
+					Time:            timestamp,
+					Package:         byVersion[key+"@"+added[0]],
+					PreviousVersion: removed[0],
+				})
+				continue
+			}
+			for _, v := range added {
+				events = append(events, SoftwareEvent{Type: SoftwareInstalled, Time: timestamp, Package: byVersion[key+"@"+v]})
+			}
+			for _, v := range removed {
+				events = append(events, SoftwareEvent{Type: SoftwareUninstalled, Time: timestamp, Package: removedPackage(key, v)})
+			}
+		}
+		for key, versions := range a.prev {
+			if _, ok := curr[key]; ok {
+				continue
+			}
+			for _, v := range versions {
+				events = append(events, SoftwareEvent{Type: SoftwareUninstalled, Time: timestamp, Package: removedPackage(key, v)})
+			}
+		}
+		sort.Slice(events, func(i, j int) bool {
+			if events[i].Package.Name != events[j].Package.Name {
+				return events[i].Package.Name < events[j].Package.Name
+			}
+			return events[i].Type < events[j].Type
+		})
+	}
+
+	a.pending = curr
+	return events, nil
+}
+
+// Commit makes the snapshot of the last call the one the next call is
+// compared with, and saves it.
+func (a *Software) Commit() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.pending == nil {
+		return nil
+	}
+	if a.Store != nil {
+		if err := a.Store.Save(softwareStateName, a.pending); err != nil {
+			return err
+		}
+	}
+	a.prev = a.pending
+	a.primed = true
+	a.pending = nil
+	return nil
+}
+
+func diffVersions(prev, curr []string) (added, removed []string) {
+	before := map[string]bool{}
+	for _, v := range prev {
+		before[v] = true
+	}
+	after := map[string]bool{}
+	for _, v := range curr {
+		after[v] = true
+		if !before[v] {
+			added = append(added, v)
+		}
+	}
+	for _, v := range prev {
+		if !after[v] {
+			removed = append(removed, v)
+		}
+	}
+	return added, removed
+}
+
+// removedPackage rebuilds what is known about a package that is gone: the
+// snapshot only keeps its source, name and version.
+func removedPackage(key, version string) Package {
+	source, name, _ := strings.Cut(key, "/")
+	return Package{Name: name, Version: version, Source: source}
+}
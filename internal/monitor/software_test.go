@@ -0,0 +1,116 @@
+package monitor
+
+import (
+	"daemon/internal/state"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffPackages(t *testing.T) {
+	store := &state.Store{Dir: t.TempDir()}
+	software := &Software{Store: store}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	events, err := software.diffPackages([]Package{
+		{Name: "curl", Version: "7.88", Source: "deb"},
+		{Name: "vim", Version: "9.0", Source: "deb"},
+		{Name: "linux-image", Version: "6.1.0-1", Source: "deb"},
+	}, nil, now)
+	require.NoError(t, err)
+	assert.Empty(t, events, "the first snapshot is only a baseline")
+	require.NoError(t, software.Commit())
+
+	// A restarted daemon picks up the saved snapshot.
+	software = &Software{Store: store}
+	events, err = software.diffPackages([]Package{
+		{Name: "curl", Version: "8.1", Source: "deb"},
+		{Name: "jq", Version: "1.6", Source: "deb"},
+		{Name: "linux-image", Version: "6.1.0-1", Source: "deb"},
+		{Name: "linux-image", Version: "6.1.0-2", Source: "deb"},
+	}, nil, now)
+	require.NoError(t, err)
+	require.Len(t, events, 4)
+
+	assert.Equal(t, SoftwareUpgraded, events[0].Type)
+	assert.Equal(t, "curl", events[0].Package.Name)
+	assert.Equal(t, "8.1", events[0].Package.Version)
+	assert.Equal(t, "7.88", events[0].PreviousVersion)
+
+	assert.Equal(t, SoftwareInstalled, events[1].Type)
+	assert.Equal(t, "jq", events[1].Package.Name)
+
+	assert.Equal(t, SoftwareInstalled, events[2].Type)
+	assert.Equal(t, "linux-image", events[2].Package.Name)
+	assert.Equal(t, "6.1.0-2", events[2].Package.Version)
+
+	assert.Equal(t, SoftwareUninstalled, events[3].Type)
+	assert.Equal(t, Package{Name: "vim", Version: "9.0", Source: "deb"}, events[3].Package)
+}
+
+func TestDiffPackagesKeepsFailedSources(t *testing.T) {
+	software := &Software{}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	_, err := software.diffPackages([]Package{
+		{Name: "curl", Version: "7.88", Source: "deb"},
+		{Name: "htop", Version: "3.2", Source: "homebrew"},
+	}, nil, now)
+	require.NoError(t, err)
+	require.NoError(t, software.Commit())
+
+	// The homebrew query failing does not uninstall htop.
+	events, err := software.diffPackages([]Package{
+		{Name: "curl", Version: "8.1", Source: "deb"},
+	}, map[string]bool{"homebrew": true}, now)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, SoftwareUpgraded, events[0].Type)
+	assert.Equal(t, "curl", events[0].Package.Name)
+	require.NoError(t, software.Commit())
+
+	// Nor is it installed again once the query succeeds.
+	events, err = software.diffPackages([]Package{
+		{Name: "curl", Version: "8.1", Source: "deb"},
+		{Name: "htop", Version: "3.2", Source: "homebrew"},
+	}, nil, now)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestDiffPackagesRepeatsUndeliveredEvents(t *testing.T) {
+	store := &state.Store{Dir: t.TempDir()}
+	software := &Software{Store: store}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	_, err := software.diffPackages([]Package{{Name: "curl", Version: "7.88", Source: "deb"}}, nil, now)
+	require.NoError(t, err)
+	require.NoError(t, software.Commit())
+
+	// The sample of this run is never delivered, so the next run reports the
+	// same upgrade, also after a restart.
+	events, err := software.diffPackages([]Package{{Name: "curl", Version: "8.1", Source: "deb"}}, nil, now)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+
+	software = &Software{Store: store}
+	events, err = software.diffPackages([]Package{{Name: "curl", Version: "8.1", Source: "deb"}}, nil, now)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, SoftwareUpgraded, events[0].Type)
+	assert.Equal(t, "7.88", events[0].PreviousVersion)
+	require.NoError(t, software.Commit())
+
+	events, err = software.diffPackages([]Package{{Name: "curl", Version: "8.1", Source: "deb"}}, nil, now)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
+
+func TestParseInstallDate(t *testing.T) {
+	assert.Nil(t, parseInstallDate(""))
+	assert.Nil(t, parseInstallDate("0"))
+	assert.Equal(t, time.Date(2023, 11, 2, 0, 0, 0, 0, time.UTC), *parseInstallDate("20231102"))
+	assert.Equal(t, time.Unix(1700000000, 0).UTC(), *parseInstallDate("1700000000"))
+}
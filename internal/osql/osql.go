@@ -0,0 +1,197 @@
+// Package osql builds the SQL the daemon sends to osquery. Queries are
+// written as constant templates with ? placeholders, and every value is
+// rendered by the package: strings as escaped literals, and names checked
+// against the identifier syntax. A path with a quote in it stays a path.
+// Compliance checks and query packs are whole queries written by whoever
+// configures the daemon, and are sent as they are.
+package osql
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// template is the SQL text of a query. It is unexported so that only
+// constants convert to it: a string variable, such as a path from the
+// config, does not compile as a template and has to go through a
+// placeholder instead.
+type template string
+
+// Ident is a table or column name, optionally qualified by a table alias,
+// e.g. p.name. It is checked when the query is built.
+type Ident string
+
+// Filter is a condition on one column, e.g. from a user supplied filter.
+// Column is checked like an Ident and Operator against Operators.
+type Filter struct {
+	Column   string
+	Operator string
+	Value    interface{}
+}
+
+// Operators are the comparison operators a Filter accepts.
+var Operators = []string{"=", "!=", "<", "<=", ">", ">=", "LIKE", "GLOB"}
+
+var identPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Build fills the ? placeholders of query with args, in order. A ? inside a
+// quoted literal or identifier of the template is left alone. Each argument
+// is rendered according to its type:
+//
+//   - string: a string literal
+//   - []string: a comma separated list of string literals, for IN (?)
+//   - int, int64, uint64, float64 and bool: a number, with bools as 1 or 0
+//   - Ident: the name itself, once validated
+//   - Filter and []Filter: the conditions joined by AND, or 1 when empty
+//
+// Any other type, a string with a NUL byte, an invalid identifier or
+// operator, and a placeholder count that does not match args are errors.
+func Build(query template, args ...interface{}) (string, error) {
+	var b strings.Builder
+	next := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			if next >= len(args) {
+				return "", fmt.Errorf("query has more placeholders than the %d arguments", len(args))
+			}
+			s, err := render(args[next])
+			if err != nil {
+				return "", fmt.Errorf("argument %d: %w", next+1, err)
+			}
+			b.WriteString(s)
+			next++
+			continue
+		}
+		b.WriteByte(c)
+	}
+	if quote != 0 {
+		return "", fmt.Errorf("query has an unterminated quote")
+	}
+	if next != len(args) {
+		return "", fmt.Errorf("query has %d placeholders for %d arguments", next, len(args))
+	}
+	return b.String(), nil
+}
+
+// MustBuild is Build for queries whose arguments cannot fail, such as a
+// template without placeholders. It panics on error.
+func MustBuild(query template, args ...interface{}) string {
+	sql, err := Build(query, args...)
+	if err != nil {
+		panic(err)
+	}
+	return sql
+}
+
+// Quote renders s as a string literal. Quotes are doubled, which is the only
+// escape SQLite knows: a backslash is an ordinary character.
+func Quote(s string) (string, error) {
+	if strings.IndexByte(s, 0) >= 0 {
+		return "", fmt.Errorf("string contains a NUL byte")
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'", nil
+}
+
+// ValidateIdent checks that name is a plain or alias qualified identifier.
+// Quoted identifiers are not accepted at all, so a name can never carry
+// anything else into a query.
+func ValidateIdent(name string) error {
+	if !identPattern.MatchString(name) {
+		return fmt.Errorf("invalid identifier %q", name)
+	}
+	return nil
+}
+
+func render(arg interface{}) (string, error) {
+	switch v := arg.(type) {
+	case string:
+		return Quote(v)
+	case []string:
+		quoted := make([]string, 0, len(v))
+		for _, s := range v {
+			q, err := Quote(s)
+			if err != nil {
+				return "", err
+			}
+			quoted = append(quoted, q)
+		}
+		return strings.Join(quoted, ", "), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		// NaN and Inf would read as column names.
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", fmt.Errorf("invalid number %v", v)
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case Ident:
+		if err := ValidateIdent(string(v)); err != nil {
+			return "", err
+		}
+		return string(v), nil
+	case Filter:
+		return renderFilter(v)
+	case []Filter:
+		if len(v) == 0 {
+			return "1", nil
+		}
+		conditions := make([]string, 0, len(v))
+		for _, f := range v {
+			c, err := renderFilter(f)
+			if err != nil {
+				return "", err
+			}
+			conditions = append(conditions, c)
+		}
+		return strings.Join(conditions, " AND "), nil
+	default:
+		return "", fmt.Errorf("unsupported argument type %T", arg)
+	}
+}
+
+func renderFilter(f Filter) (string, error) {
+	if err := ValidateIdent(f.Column); err != nil {
+		return "", err
+	}
+	operator := strings.ToUpper(f.Operator)
+	valid := false
+	for _, op := range Operators {
+		if operator == op {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return "", fmt.Errorf("invalid operator %q", f.Operator)
+	}
+	switch f.Value.(type) {
+	case Ident, Filter, []Filter, []string:
+		return "", fmt.Errorf("unsupported filter value type %T", f.Value)
+	}
+	value, err := render(f.Value)
+	if err != nil {
+		return "", err
+	}
+	return "(" + f.Column + " " + operator + " " + value + ")", nil
+}
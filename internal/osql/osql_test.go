@@ -0,0 +1,177 @@
+package osql
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuild(t *testing.T) {
+	sql, err := Build("SELECT path, size FROM file WHERE directory IN (?) AND size > ?", []string{"/tmp/it's", "/var"}, int64(10))
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT path, size FROM file WHERE directory IN ('/tmp/it''s', '/var') AND size > 10", sql)
+
+	// Placeholders inside quotes of the template are text.
+	sql, err = Build("SELECT '?' AS q, \"a?\" FROM t WHERE status = 'it''s ?' AND x = ?", true)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT '?' AS q, \"a?\" FROM t WHERE status = 'it''s ?' AND x = 1", sql)
+
+	sql, err = Build("SELECT ? FROM users WHERE ?", Ident("u.username"), []Filter{
+		{Column: "uid", Operator: ">=", Value: 500},
+		{Column: "shell", Operator: "like", Value: "%sh' OR 1=1 --"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT u.username FROM users WHERE (uid >= 500) AND (shell LIKE '%sh'' OR 1=1 --')", sql)
+
+	sql, err = Build("SELECT * FROM users WHERE ?", []Filter(nil))
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM users WHERE 1", sql)
+}
+
+func TestBuildErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		query template
+		args  []interface{}
+	}{
+		"too few args":       {"SELECT ? FROM ?", []interface{}{"a"}},
+		"too many args":      {"SELECT 1", []interface{}{"a"}},
+		"unterminated quote": {"SELECT 'a", nil},
+		"NUL byte":           {"SELECT ?", []interface{}{"a\x00' OR 1=1"}},
+		"bad identifier":     {"SELECT ? FROM t", []interface{}{Ident("name; DROP")}},
+		"quoted identifier":  {"SELECT ? FROM t", []interface{}{Ident(`"name"`)}},
+		"bad operator":       {"SELECT 1 WHERE ?", []interface{}{Filter{Column: "a", Operator: "= 1 OR", Value: 1}}},
+		"bad filter column":  {"SELECT 1 WHERE ?", []interface{}{Filter{Column: "1=1 OR a", Operator: "=", Value: 1}}},
+		"list filter value":  {"SELECT 1 WHERE ?", []interface{}{Filter{Column: "a", Operator: "=", Value: []string{"x"}}}},
+		"ident filter value": {"SELECT 1 WHERE ?", []interface{}{Filter{Column: "a", Operator: "=", Value: Ident("b")}}},
+		"unsupported type":   {"SELECT ?", []interface{}{struct{}{}}},
+		"NaN":                {"SELECT ?", []interface{}{math.NaN()}},
+	} {
+		_, err := Build(tc.query, tc.args...)
+		assert.Error(t, err, name)
+	}
+	assert.Panics(t, func() { MustBuild("SELECT ?") })
+}
+
+func TestValidateIdent(t *testing.T) {
+	for _, name := range []string{"path", "p.name", "_private", "column2"} {
+		assert.NoError(t, ValidateIdent(name), name)
+	}
+	for _, name := range []string{"", "2col", "a.b.c", "a b", "a-b", "a;", "a'", "a--", "é", "a.", ".a"} {
+		assert.Error(t, ValidateIdent(name), name)
+	}
+}
+
+// tokenize splits sql into tokens the way SQLite does for what Build
+// emits: string literals, with doubled quotes, and everything else split on
+// spaces and punctuation.
+func tokenize(t *testing.T, sql string) []string {
+	var tokens []string
+	for i := 0; i < len(sql); {
+		switch c := sql[i]; {
+		case c == ' ':
+			i++
+		case c == '\'':
+			j := i + 1
+			for {
+				require.Less(t, j, len(sql), "unterminated literal in %q", sql)
+				if sql[j] == '\'' {
+					if j+1 < len(sql) && sql[j+1] == '\'' {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			tokens = append(tokens, sql[i:j+1])
+			i = j + 1
+		case strings.IndexByte("(),=", c) >= 0:
+			tokens = append(tokens, string(c))
+			i++
+		default:
+			j := i
+			for j < len(sql) && strings.IndexByte(" (),='", sql[j]) < 0 {
+				j++
+			}
+			tokens = append(tokens, sql[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
+
+// unquote reverses Quote.
+func unquote(literal string) string {
+	return strings.ReplaceAll(literal[1:len(literal)-1], "''", "'")
+}
+
+func FuzzQuote(f *testing.F) {
+	for _, seed := range []string{
+		"", "plain", "it's", "''", "'", `\'`, `\`, "' OR '1'='1", "'; DROP TABLE file; --",
+		"/* comment", "--", "\"", "?", "a\nb", "café", "\xff\xfe", "a\x00b",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		sql, err := Build("SELECT path FROM file WHERE path = ? AND directory IN (?)", s, []string{s, s})
+		if strings.IndexByte(s, 0) >= 0 {
+			require.Error(t, err)
+			return
+		}
+		require.NoError(t, err)
+
+		// Whatever s holds, the query keeps its shape and the literals
+		// read back as s.
+		tokens := tokenize(t, sql)
+		require.Len(t, tokens, 16, "%q", sql)
+		assert.Equal(t, []string{"SELECT", "path", "FROM", "file", "WHERE", "path", "="}, tokens[:7])
+		assert.Equal(t, []string{"AND", "directory", "IN", "("}, tokens[8:12])
+		assert.Equal(t, []string{",", ")"}, []string{tokens[13], tokens[15]})
+		assert.Equal(t, s, unquote(tokens[7]))
+		assert.Equal(t, s, unquote(tokens[12]))
+		assert.Equal(t, s, unquote(tokens[14]))
+	})
+}
+
+func FuzzIdent(f *testing.F) {
+	for _, seed := range []string{"path", "p.name", "a b", "a;--", `"x"`, "x'", "a.b.c", ""} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		sql, err := Build("SELECT ? FROM file", Ident(name))
+		if err != nil {
+			return
+		}
+		// An accepted name is a single token of letters, digits,
+		// underscores and at most one dot.
+		assert.Equal(t, "SELECT "+name+" FROM file", sql)
+		for _, c := range name {
+			assert.True(t, c == '_' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9'), "%q", name)
+		}
+		assert.LessOrEqual(t, strings.Count(name, "."), 1)
+	})
+}
+
+func FuzzFilter(f *testing.F) {
+	f.Add("path", "=", "x")
+	f.Add("path", "LIKE", "%' OR 1=1 --")
+	f.Add("path = 'a' OR path", "=", "x")
+	f.Add("path", "= 'a' OR path =", "x")
+	f.Fuzz(func(t *testing.T, column, operator, value string) {
+		sql, err := Build("SELECT path FROM file WHERE ?", Filter{Column: column, Operator: operator, Value: value})
+		if err != nil {
+			return
+		}
+		require.NoError(t, ValidateIdent(column))
+		assert.Contains(t, Operators, strings.ToUpper(operator))
+		prefix := "SELECT path FROM file WHERE (" + column + " " + strings.ToUpper(operator) + " "
+		require.True(t, strings.HasPrefix(sql, prefix), "%q", sql)
+		literal := strings.TrimSuffix(strings.TrimPrefix(sql, prefix), ")")
+		tokens := tokenize(t, literal)
+		require.Len(t, tokens, 1, "%q", sql)
+		assert.Equal(t, value, unquote(tokens[0]))
+	})
+}
@@ -0,0 +1,229 @@
+package pack
+
+import (
+	"context"
+	"crypto/sha256"
+	"daemon/internal/collector"
+	"daemon/internal/state"
+	"daemon/internal/stats"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/osquery/osquery-go"
+)
+
+const (
+	ModeSnapshot     = "snapshot"
+	ModeDifferential = "differential"
+)
+
+// Pack is a named group of scheduled queries, in the spirit of osqueryd's
+// query packs but run by the daemon over its own osquery socket.
+type Pack struct {
+	Name    string  `mapstructure:"name" validate:"required"`
+	Queries []Query `mapstructure:"queries" validate:"required,dive"`
+}
+
+// validName is what pack and query names are limited to, since they name
+// the state files of differential queries.
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Validate rejects names that are not letters, digits, _ and -, and queries
+// that share a name: they would run as one collector and share their
+// differential state.
+func (p Pack) Validate() error {
+	if !validName.MatchString(p.Name) {
+		return fmt.Errorf("invalid pack name %q, expected letters, digits, _ and -", p.Name)
+	}
+	names := map[string]bool{}
+	for _, q := range p.Queries {
+		if !validName.MatchString(q.Name) {
+			return fmt.Errorf("pack %q: invalid query name %q, expected letters, digits, _ and -", p.Name, q.Name)
+		}
+		if names[q.Name] {
+			return fmt.Errorf("pack %q: duplicate query name %q", p.Name, q.Name)
+		}
+		names[q.Name] = true
+	}
+	return nil
+}
+
+type Query struct {
+	Name string `mapstructure:"name" validate:"required"`
+	SQL  string `mapstructure:"sql" validate:"required"`
+	// Interval defaults to the collector default, check_frequency.
+	Interval time.Duration `mapstructure:"interval"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+	// Mode is snapshot (every row, every run) or differential (only the rows
+	// added or removed since the previous run). Defaults to snapshot.
+	Mode string `mapstructure:"mode" validate:"omitempty,oneof=snapshot differential"`
+}
+
+// Collector runs one query of a pack. Differential queries keep the rows of
+// their last delivered run in Store so that a restart does not report every
+// row as new again.
+type Collector struct {
+	OsqueryInstance   *osquery.ExtensionManagerServer
+	OsquerySocketPath string
+	Pack              string
+	Query             Query
+	Store             *state.Store
+
+	mutex   sync.Mutex
+	pending *differentialState
+}
+
+// differentialState is what a differential query persists between runs.
+type differentialState struct {
+	// SQLHash detects edits to the query, which invalidate the saved rows.
+	SQLHash string              `json:"sql_hash"`
+	Counter int                 `json:"counter"`
+	Rows    []map[string]string `json:"rows"`
+}
+
+func (c *Collector) Name() string {
+	return "pack:" + c.Pack + "/" + c.Query.Name
+}
+
+// Settings returns the schedule of the query for the collector registry.
+func (c *Collector) Settings() collector.Settings {
+	return collector.Settings{Interval: c.Query.Interval, Timeout: c.Query.Timeout}
+}
+
+func (c *Collector) Collect(ctx context.Context) (collector.Result, error) {
+	if c.OsqueryInstance == nil {
+		return nil, fmt.Errorf("osquery instance not initialized")
+	}
+
+	client, err := osquery.NewClient(c.OsquerySocketPath, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create osquery client: %w", err)
+	}
+	defer client.Close()
+
+	response, err := client.QueryContext(ctx, c.Query.SQL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	if status := response.GetStatus(); status != nil && status.Code != 0 {
+		return nil, fmt.Errorf("query failed: %s", status.Message)
+	}
+
+	result := stats.QueryResult{
+		Pack:  c.Pack,
+		Query: c.Query.Name,
+		Mode:  c.mode(),
+	}
+	if result.Mode == ModeSnapshot {
+		result.Rows = nonNil(response.Response)
+	} else {
+		result.Added, result.Removed, result.Counter, err = c.diff(response.Response)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return func(s *stats.Sample) {
+		s.Queries = append(s.Queries, result)
+	}, nil
+}
+
+func (c *Collector) mode() string {
+	if c.Query.Mode == "" {
+		return ModeSnapshot
+	}
+	return c.Query.Mode
+}
+
+// diff compares rows with the last committed run and keeps them pending as
+// the new baseline. Like osqueryd, the first run reports every row as
+// added.
+func (c *Collector) diff(rows []map[string]string) (added, removed []map[string]string, counter int, err error) {
+	name := c.stateName()
+	sum := sha256.Sum256([]byte(c.Query.SQL))
+	sqlHash := hex.EncodeToString(sum[:])
+
+	var prev differentialState
+	found, err := c.Store.Load(name, &prev)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if found && prev.SQLHash == sqlHash {
+		counter = prev.Counter + 1
+	} else {
+		prev = differentialState{}
+	}
+
+	added, removed = diffRows(prev.Rows, rows)
+
+	c.mutex.Lock()
+	c.pending = &differentialState{SQLHash: sqlHash, Counter: counter, Rows: nonNil(rows)}
+	c.mutex.Unlock()
+	return added, removed, counter, nil
+}
+
+// Commit saves the rows of the last differential run as the baseline of the
+// next one, once its result was delivered. An undelivered run leaves the
+// baseline as it was, so its rows are reported as added or removed again.
+func (c *Collector) Commit() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.pending == nil {
+		return nil
+	}
+	if err := c.Store.Save(c.stateName(), c.pending); err != nil {
+		return err
+	}
+	c.pending = nil
+	return nil
+}
+
+// stateName relies on Validate: the names are path elements as they are.
+func (c *Collector) stateName() string {
+	return "packs/" + c.Pack + "/" + c.Query.Name
+}
+
+// diffRows treats rows as a multiset keyed by their full content.
+func diffRows(prev, curr []map[string]string) (added, removed []map[string]string) {
+	counts := make(map[string]int, len(prev))
+	for _, r := range prev {
+		counts[rowKey(r)]++
+	}
+
+	added = []map[string]string{}
+	for _, r := range curr {
+		key := rowKey(r)
+		if counts[key] > 0 {
+			counts[key]--
+			continue
+		}
+		added = append(added, r)
+	}
+
+	removed = []map[string]string{}
+	for _, r := range prev {
+		key := rowKey(r)
+		if counts[key] > 0 {
+			counts[key]--
+			removed = append(removed, r)
+		}
+	}
+	return added, removed
+}
+
+// rowKey relies on encoding/json writing map keys in sorted order.
+func rowKey(r map[string]string) string {
+	data, _ := json.Marshal(r)
+	return string(data)
+}
+
+func nonNil(rows []map[string]string) []map[string]string {
+	if rows == nil {
+		return []map[string]string{}
+	}
+	return rows
+}
@@ -0,0 +1,90 @@
+package pack
+
+import (
+	"daemon/internal/state"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDifferentialSurvivesRestart(t *testing.T) {
+	store := &state.Store{Dir: t.TempDir()}
+	query := Query{Name: "listeners", SQL: "SELECT port FROM listening_ports", Mode: ModeDifferential}
+
+	first := &Collector{Pack: "security", Query: query, Store: store}
+	added, removed, counter, err := first.diff([]map[string]string{{"port": "22"}, {"port": "80"}})
+	require.NoError(t, err)
+	assert.Len(t, added, 2)
+	assert.Empty(t, removed)
+	assert.Equal(t, 0, counter)
+	require.NoError(t, first.Commit())
+
+	// A fresh collector stands in for a restarted daemon.
+	second := &Collector{Pack: "security", Query: query, Store: store}
+	added, removed, counter, err = second.diff([]map[string]string{{"port": "22"}, {"port": "443"}})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]string{{"port": "443"}}, added)
+	assert.Equal(t, []map[string]string{{"port": "80"}}, removed)
+	assert.Equal(t, 1, counter)
+	require.NoError(t, second.Commit())
+
+	query.SQL = "SELECT port, pid FROM listening_ports"
+	edited := &Collector{Pack: "security", Query: query, Store: store}
+	added, _, counter, err = edited.diff([]map[string]string{{"port": "22", "pid": "1"}})
+	require.NoError(t, err)
+	assert.Len(t, added, 1)
+	assert.Equal(t, 0, counter)
+}
+
+func TestDifferentialRepeatsUndeliveredRows(t *testing.T) {
+	store := &state.Store{Dir: t.TempDir()}
+	query := Query{Name: "listeners", SQL: "SELECT port FROM listening_ports", Mode: ModeDifferential}
+	c := &Collector{Pack: "security", Query: query, Store: store}
+
+	_, _, _, err := c.diff([]map[string]string{{"port": "22"}})
+	require.NoError(t, err)
+	require.NoError(t, c.Commit())
+
+	// The sample of this run is never delivered, so the next run reports
+	// the same change, along with its own.
+	added, _, _, err := c.diff([]map[string]string{{"port": "22"}, {"port": "80"}})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]string{{"port": "80"}}, added)
+
+	added, removed, counter, err := c.diff([]map[string]string{{"port": "80"}, {"port": "443"}})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]string{{"port": "80"}, {"port": "443"}}, added)
+	assert.Equal(t, []map[string]string{{"port": "22"}}, removed)
+	assert.Equal(t, 1, counter)
+	require.NoError(t, c.Commit())
+
+	added, removed, counter, err = c.diff([]map[string]string{{"port": "80"}, {"port": "443"}})
+	require.NoError(t, err)
+	assert.Empty(t, added)
+	assert.Empty(t, removed)
+	assert.Equal(t, 2, counter)
+}
+
+func TestValidateRejectsDuplicateQueries(t *testing.T) {
+	p := Pack{Name: "security", Queries: []Query{
+		{Name: "listeners", SQL: "SELECT port FROM listening_ports"},
+		{Name: "users", SQL: "SELECT username FROM users"},
+	}}
+	assert.NoError(t, p.Validate())
+
+	p.Queries = append(p.Queries, Query{Name: "listeners", SQL: "SELECT pid FROM listening_ports"})
+	assert.ErrorContains(t, p.Validate(), `duplicate query name "listeners"`)
+}
+
+func TestValidateRejectsUnsafeNames(t *testing.T) {
+	query := Query{Name: "listeners", SQL: "SELECT port FROM listening_ports"}
+	assert.NoError(t, Pack{Name: "security_v2-b", Queries: []Query{query}}.Validate())
+
+	for _, name := range []string{"..", ".", "a/b", `a\b`, "a.b", "", "a b"} {
+		assert.Error(t, Pack{Name: name, Queries: []Query{query}}.Validate(), name)
+		bad := query
+		bad.Name = name
+		assert.Error(t, Pack{Name: "security", Queries: []Query{bad}}.Validate(), name)
+	}
+}
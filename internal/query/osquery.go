@@ -0,0 +1,65 @@
+package query
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/osquery/osquery-go"
+)
+
+type Osquery struct {
+	OsquerySocketPath string
+	OsqueryInstance   *osquery.ExtensionManagerServer
+	Logger            *log.Logger
+}
+
+func (a *Osquery) InitOsquery() error {
+	socketPath, err := a.discoverOsquerySocket()
+	if err != nil {
+		return fmt.Errorf("failed to discover osquery %s: %w", socketKind, err)
+	}
+
+	a.OsquerySocketPath = socketPath
+
+	server, err := osquery.NewExtensionManagerServer("file_monitor", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to create osquery extension: %w", err)
+	}
+
+	a.OsqueryInstance = server
+
+	go func() {
+		if err := server.Run(); err != nil {
+			a.Logger.Printf("osquery extension server stopped: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+// firstExisting returns the first of paths that exists.
+func firstExisting(paths []string) (string, error) {
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("could not discover osquery %s", socketKind)
+}
+
+func (a *Osquery) GetOsqueryStatus() string {
+	if a.OsquerySocketPath == "" {
+		return fmt.Sprintf("Osquery %s not set. Has initOsquery been called?", socketKind)
+	}
+
+	if _, err := os.Stat(a.OsquerySocketPath); os.IsNotExist(err) {
+		return fmt.Sprintf("Osquery %s not found at %s. Is osqueryd running?", socketKind, a.OsquerySocketPath)
+	}
+
+	if a.OsqueryInstance == nil {
+		return fmt.Sprintf("Osquery %s found, but extension is not initialized", socketKind)
+	}
+
+	return fmt.Sprintf("Osquery is running and extension is initialized. %s: %s", socketKind, a.OsquerySocketPath)
+}
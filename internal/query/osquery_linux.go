@@ -0,0 +1,30 @@
+package query
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+)
+
+const socketKind = "socket"
+
+func (a *Osquery) discoverOsquerySocket() (string, error) {
+	if envSocket := os.Getenv("OSQUERY_SOCKET"); envSocket != "" {
+		return envSocket, nil
+	}
+
+	currentUser, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current user: %w", err)
+	}
+
+	// osqueryd from the distribution packages listens on
+	// /var/osquery/osquery.em, osqueryi on ~/.osquery/shell.em.
+	return firstExisting([]string{
+		"/var/osquery/osquery.em",
+		filepath.Join(currentUser.HomeDir, ".osquery", "shell.em"),
+		"/var/run/osquery/osquery.em",
+		"/var/osquery/osquery.sock",
+	})
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultName is the name the daemon is installed under unless another is
+// given.
+const DefaultName = "daemon"
+
+// Config describes how the operating system should run the daemon.
+type Config struct {
+	Name        string
+	DisplayName string
+	Description string
+	// Executable is the absolute path of the daemon binary and Args the
+	// arguments it is started with.
+	Executable string
+	Args       []string
+	// WorkingDirectory is also used as the home directory of the service, so
+	// the stats log and collector state end up next to it. It is passed as
+	// -work-dir too, for service managers that cannot set the environment.
+	WorkingDirectory string
+	LogDirectory     string
+}
+
+// Install registers the daemon with the service manager of the platform,
+// starts it and makes it start on boot. An existing installation under the
+// same name is replaced.
+func Install(cfg Config) error {
+	if !filepath.IsAbs(cfg.Executable) {
+		return fmt.Errorf("executable path %q is not absolute", cfg.Executable)
+	}
+	for _, dir := range []string{cfg.WorkingDirectory, cfg.LogDirectory} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+	}
+	return install(cfg)
+}
+
+// Uninstall stops the service and removes it from the service manager. The
+// working and log directories are left in place.
+func Uninstall(name string) error {
+	return uninstall(name)
+}
+
+// Run calls run with a context that is cancelled when the service manager,
+// or the user at a terminal, asks the daemon to stop.
+func Run(name string, run func(ctx context.Context) error) error {
+	return runService(name, run)
+}
+
+// UseWorkingDirectory changes into dir and makes it the home directory of
+// the process, which is where the stats log and collector state are kept.
+// The Windows service manager sets neither, so the daemon does it itself.
+func UseWorkingDirectory(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		return fmt.Errorf("failed to change into %s: %w", dir, err)
+	}
+	// os.UserHomeDir reads USERPROFILE on Windows and HOME elsewhere.
+	for _, key := range []string{"HOME", "USERPROFILE"} {
+		if err := os.Setenv(key, dir); err != nil {
+			return fmt.Errorf("failed to set %s: %w", key, err)
+		}
+	}
+	return nil
+}
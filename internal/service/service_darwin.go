@@ -0,0 +1,133 @@
+package service
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// plistDir holds the launchd jobs that run as root at boot.
+var plistDir = "/Library/LaunchDaemons"
+
+func DefaultWorkingDirectory(name string) string {
+	return filepath.Join("/Library/Application Support", name)
+}
+
+func DefaultLogDirectory(name string) string {
+	return filepath.Join("/Library/Logs", name)
+}
+
+// label follows the reverse DNS convention launchd expects.
+func label(name string) string {
+	return "com." + name + ".agent"
+}
+
+var plistTemplate = template.Must(template.New("plist").Funcs(template.FuncMap{"xml": xmlEscape}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>{{xml .Label}}</string>
+	<key>ProgramArguments</key>
+	<array>
+{{- range .Args}}
+		<string>{{xml .}}</string>
+{{- end}}
+	</array>
+	<key>WorkingDirectory</key>
+	<string>{{xml .WorkingDirectory}}</string>
+	<key>EnvironmentVariables</key>
+	<dict>
+		<key>HOME</key>
+		<string>{{xml .WorkingDirectory}}</string>
+	</dict>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<key>ThrottleInterval</key>
+	<integer>10</integer>
+	<key>StandardOutPath</key>
+	<string>{{xml .StdoutPath}}</string>
+	<key>StandardErrorPath</key>
+	<string>{{xml .StderrPath}}</string>
+</dict>
+</plist>
+`))
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func plistPath(name string) string {
+	return filepath.Join(plistDir, label(name)+".plist")
+}
+
+func launchdPlist(cfg Config) ([]byte, error) {
+	var plist bytes.Buffer
+	err := plistTemplate.Execute(&plist, struct {
+		Label            string
+		Args             []string
+		WorkingDirectory string
+		StdoutPath       string
+		StderrPath       string
+	}{
+		Label:            label(cfg.Name),
+		Args:             append([]string{cfg.Executable}, cfg.Args...),
+		WorkingDirectory: cfg.WorkingDirectory,
+		StdoutPath:       filepath.Join(cfg.LogDirectory, "stdout.log"),
+		StderrPath:       filepath.Join(cfg.LogDirectory, "stderr.log"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render launchd plist: %w", err)
+	}
+	return plist.Bytes(), nil
+}
+
+func install(cfg Config) error {
+	plist, err := launchdPlist(cfg)
+	if err != nil {
+		return err
+	}
+	path := plistPath(cfg.Name)
+	if _, err := os.Stat(path); err == nil {
+		// Unload the previous job so launchd picks up the new definition.
+		launchctl("bootout", "system/"+label(cfg.Name))
+	}
+	if err := os.WriteFile(path, plist, 0644); err != nil {
+		return fmt.Errorf("failed to write launchd plist: %w", err)
+	}
+	return launchctl("bootstrap", "system", path)
+}
+
+func uninstall(name string) error {
+	path := plistPath(name)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return fmt.Errorf("service %s is not installed", name)
+	}
+	if err := launchctl("bootout", "system/"+label(name)); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove launchd plist: %w", err)
+	}
+	return nil
+}
+
+func launchctl(args ...string) error {
+	output, err := exec.Command("launchctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("launchctl %s failed: %w: %s", strings.Join(args, " "), err, bytes.TrimSpace(output))
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// unitDir is where units installed by the administrator live.
+var unitDir = "/etc/systemd/system"
+
+func DefaultWorkingDirectory(name string) string {
+	return filepath.Join("/var/lib", name)
+}
+
+func DefaultLogDirectory(name string) string {
+	return filepath.Join("/var/log", name)
+}
+
+var unitTemplate = template.Must(template.New("unit").Parse(`[Unit]
+Description={{.Description}}
+After=network-online.target osqueryd.service
+Wants=network-online.target
+StartLimitIntervalSec=300
+StartLimitBurst=10
+
+[Service]
+Type=simple
+ExecStart={{.ExecStart}}
+WorkingDirectory={{.WorkingDirectory}}
+Environment={{.Environment}}
+Restart=on-failure
+RestartSec=5
+TimeoutStopSec=30
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+func unitPath(name string) string {
+	return filepath.Join(unitDir, name+".service")
+}
+
+func systemdUnit(cfg Config) ([]byte, error) {
+	args := make([]string, 0, len(cfg.Args)+1)
+	for _, arg := range append([]string{cfg.Executable}, cfg.Args...) {
+		args = append(args, systemdQuote(arg))
+	}
+
+	var unit bytes.Buffer
+	err := unitTemplate.Execute(&unit, struct {
+		Description      string
+		ExecStart        string
+		WorkingDirectory string
+		Environment      string
+	}{
+		Description:      cfg.Description,
+		ExecStart:        strings.Join(args, " "),
+		WorkingDirectory: cfg.WorkingDirectory,
+		Environment:      systemdQuote("HOME=" + cfg.WorkingDirectory),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render systemd unit: %w", err)
+	}
+	return unit.Bytes(), nil
+}
+
+// systemdQuote quotes an ExecStart argument. Specifiers start with % in unit
+// files, so a literal % is doubled.
+func systemdQuote(arg string) string {
+	arg = strings.ReplaceAll(arg, "%", "%%")
+	if !strings.ContainsAny(arg, " \t\"'\\;$") {
+		return arg
+	}
+	arg = strings.ReplaceAll(arg, `\`, `\\`)
+	arg = strings.ReplaceAll(arg, `"`, `\"`)
+	return `"` + arg + `"`
+}
+
+func install(cfg Config) error {
+	unit, err := systemdUnit(cfg)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(unitPath(cfg.Name), unit, 0644); err != nil {
+		return fmt.Errorf("failed to write systemd unit: %w", err)
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	if err := systemctl("enable", cfg.Name); err != nil {
+		return err
+	}
+	return systemctl("restart", cfg.Name)
+}
+
+func uninstall(name string) error {
+	if _, err := os.Stat(unitPath(name)); os.IsNotExist(err) {
+		return fmt.Errorf("service %s is not installed", name)
+	}
+	if err := systemctl("disable", "--now", name); err != nil {
+		return err
+	}
+	if err := os.Remove(unitPath(name)); err != nil {
+		return fmt.Errorf("failed to remove systemd unit: %w", err)
+	}
+	return systemctl("daemon-reload")
+}
+
+func systemctl(args ...string) error {
+	output, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s failed: %w: %s", strings.Join(args, " "), err, bytes.TrimSpace(output))
+	}
+	return nil
+}
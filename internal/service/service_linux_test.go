@@ -0,0 +1,32 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSystemdUnit(t *testing.T) {
+	unit, err := systemdUnit(Config{
+		Name:             "daemon",
+		Description:      "Daemon monitoring agent",
+		Executable:       "/opt/daemon/daemon",
+		Args:             []string{"-headless", "-config", "/etc/daemon/my config.yaml"},
+		WorkingDirectory: "/var/lib/daemon",
+		LogDirectory:     "/var/log/daemon",
+	})
+	require.NoError(t, err)
+
+	assert.Contains(t, string(unit), `ExecStart=/opt/daemon/daemon -headless -config "/etc/daemon/my config.yaml"`)
+	assert.Contains(t, string(unit), "WorkingDirectory=/var/lib/daemon\n")
+	assert.Contains(t, string(unit), "Environment=HOME=/var/lib/daemon\n")
+	assert.Contains(t, string(unit), "Restart=on-failure\n")
+}
+
+func TestSystemdQuote(t *testing.T) {
+	assert.Equal(t, "plain", systemdQuote("plain"))
+	assert.Equal(t, `"a b"`, systemdQuote("a b"))
+	assert.Equal(t, `"say \"hi\""`, systemdQuote(`say "hi"`))
+	assert.Equal(t, "100%%", systemdQuote("100%"))
+}
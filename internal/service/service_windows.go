@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+func programData() string {
+	if dir := os.Getenv("ProgramData"); dir != "" {
+		return dir
+	}
+	return `C:\ProgramData`
+}
+
+func DefaultWorkingDirectory(name string) string {
+	return filepath.Join(programData(), name)
+}
+
+func DefaultLogDirectory(name string) string {
+	return filepath.Join(programData(), name, "logs")
+}
+
+func install(cfg Config) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(cfg.Name); err == nil {
+		s.Close()
+		if err := uninstall(cfg.Name); err != nil {
+			return fmt.Errorf("failed to replace existing service: %w", err)
+		}
+	}
+
+	s, err := m.CreateService(cfg.Name, cfg.Executable, mgr.Config{
+		DisplayName:  cfg.DisplayName,
+		Description:  cfg.Description,
+		StartType:    mgr.StartAutomatic,
+		ErrorControl: mgr.ErrorNormal,
+	}, cfg.Args...)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	defer s.Close()
+
+	// Restart after a crash, backing off a little, and forget about earlier
+	// failures after a day.
+	err = s.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: 30 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: time.Minute},
+	}, uint32((24 * time.Hour).Seconds()))
+	if err != nil {
+		return fmt.Errorf("failed to set recovery actions: %w", err)
+	}
+
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("failed to start service: %w", err)
+	}
+	return nil
+}
+
+func uninstall(name string) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed: %w", name, err)
+	}
+	defer s.Close()
+
+	status, err := s.Control(svc.Stop)
+	if err == nil {
+		deadline := time.Now().Add(30 * time.Second)
+		for status.State != svc.Stopped && time.Now().Before(deadline) {
+			time.Sleep(500 * time.Millisecond)
+			if status, err = s.Query(); err != nil {
+				break
+			}
+		}
+	} else if !errors.Is(err, windows.ERROR_SERVICE_NOT_ACTIVE) {
+		return fmt.Errorf("failed to stop service: %w", err)
+	}
+
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("failed to delete service: %w", err)
+	}
+	return nil
+}
+
+// runService hands control to the service manager when started by it, and
+// otherwise stops on Ctrl+C like the other platforms.
+func runService(name string, run func(ctx context.Context) error) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return fmt.Errorf("failed to detect service mode: %w", err)
+	}
+	if !isService {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return run(ctx)
+	}
+
+	h := &handler{run: run}
+	if err := svc.Run(name, h); err != nil {
+		return fmt.Errorf("failed to run as service: %w", err)
+	}
+	return h.err
+}
+
+type handler struct {
+	run func(ctx context.Context) error
+	err error
+}
+
+// Execute runs the daemon until it fails or the service manager sends stop
+// or shutdown.
+func (h *handler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown
+
+	status <- svc.Status{State: svc.StartPending}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- h.run(ctx)
+	}()
+	status <- svc.Status{State: svc.Running, Accepts: accepted}
+
+	for {
+		select {
+		case err := <-done:
+			h.err = err
+			if err != nil {
+				return true, 1
+			}
+			return false, 0
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				status <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+				h.err = <-done
+				return false, 0
+			}
+		}
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package service
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// runService stops on SIGINT and SIGTERM, which is how both systemd and
+// launchd stop a service.
+func runService(name string, run func(ctx context.Context) error) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return run(ctx)
+}
@@ -0,0 +1,89 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrCorrupt is returned by Load for a state file that cannot be decoded.
+var ErrCorrupt = errors.New("corrupt state")
+
+// Store persists small pieces of collector state as JSON files so that
+// change tracking survives a restart of the daemon.
+type Store struct {
+	Dir string
+}
+
+// DefaultDir is used when the config does not set state_directory.
+func DefaultDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".daemon", "state"), nil
+}
+
+// Load decodes the state saved under name into v. It reports false, and
+// leaves v untouched, when nothing has been saved yet.
+func (s *Store) Load(name string, v interface{}) (bool, error) {
+	data, err := os.ReadFile(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read state %s: %w", name, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("failed to decode state %s: %w: %w", name, ErrCorrupt, err)
+	}
+	return true, nil
+}
+
+// Save replaces the state saved under name. The file is written next to its
+// final location and renamed into place, so a crash never leaves half a file.
+func (s *Store) Save(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode state %s: %w", name, err)
+	}
+
+	path := s.path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state %s: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state %s: %w", name, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace state %s: %w", name, err)
+	}
+	return nil
+}
+
+// Delete forgets the state saved under name.
+func (s *Store) Delete(name string) error {
+	err := os.Remove(s.path(name))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete state %s: %w", name, err)
+	}
+	return nil
+}
+
+// path maps a slash separated name such as "packs/security/suid" to a file
+// under Dir.
+func (s *Store) path(name string) string {
+	return filepath.Join(s.Dir, filepath.FromSlash(name)+".json")
+}
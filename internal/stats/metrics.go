@@ -0,0 +1,93 @@
+package stats
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Metric is a single numeric series value taken from a sample. Series with
+// the same Name are told apart by Labels, such as the mount of a disk.
+type Metric struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// Metrics flattens the numeric parts of the sample that alert rules and
+// baselines are evaluated against. Values that were not collected this tick
+// are left out rather than reported as zero.
+func (s *Sample) Metrics() []Metric {
+	var metrics []Metric
+	add := func(name string, value *float64, labels map[string]string) {
+		if value != nil {
+			metrics = append(metrics, Metric{Name: name, Labels: labels, Value: *value})
+		}
+	}
+	addValue := func(name string, value float64, labels map[string]string) {
+		add(name, &value, labels)
+	}
+
+	if s.System != nil {
+		add("cpu_percent", s.System.CPUPercent, nil)
+		add("memory_used_percent", s.System.MemoryUsedPercent, nil)
+		if s.System.CPU != nil && s.System.CPU.LoadAverage != nil {
+			addValue("load_1m", s.System.CPU.LoadAverage.One, nil)
+		}
+		if s.System.Memory != nil && s.System.Memory.SwapTotalBytes != nil && s.System.Memory.SwapUsedBytes != nil && *s.System.Memory.SwapTotalBytes > 0 {
+			addValue("swap_used_percent", float64(*s.System.Memory.SwapUsedBytes)*100/float64(*s.System.Memory.SwapTotalBytes), nil)
+		}
+		if s.System.Disk != nil {
+			for _, m := range s.System.Disk.Mounts {
+				addValue("disk_used_percent", m.UsedPercent, map[string]string{"mount": m.Path})
+			}
+		}
+	}
+
+	if s.Network != nil {
+		for _, i := range s.Network.Interfaces {
+			labels := map[string]string{"interface": i.Interface}
+			add("network_bytes_in_per_sec", i.BytesInPerSec, labels)
+			add("network_bytes_out_per_sec", i.BytesOutPerSec, labels)
+			add("network_errors_per_sec", i.ErrorsPerSec, labels)
+		}
+	}
+
+	for _, w := range s.Watches {
+		if w.FilesModified != nil {
+			addValue("files_modified", float64(*w.FilesModified), map[string]string{"watch": w.Name})
+		}
+	}
+	// The total has its own name, so that a rule on it without labels does
+	// not also match every watch entry.
+	if s.FilesModified != nil {
+		addValue("files_modified_total", float64(*s.FilesModified), nil)
+	}
+	for _, i := range s.Integrity {
+		if !i.Baseline {
+			addValue("integrity_violations", float64(len(i.Violations)), map[string]string{"watch": i.Name})
+		}
+	}
+
+	return metrics
+}
+
+// String identifies the series in Prometheus style, e.g.
+// disk_used_percent{mount="/"}. Labels are sorted and values quoted, so a
+// value holding a comma or an equals sign cannot pass for another label and
+// the string can be used as a key.
+func (m Metric) String() string {
+	if len(m.Labels) == 0 {
+		return m.Name
+	}
+	keys := make([]string, 0, len(m.Labels))
+	for k := range m.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+strconv.Quote(m.Labels[k]))
+	}
+	return m.Name + "{" + strings.Join(parts, ",") + "}"
+}
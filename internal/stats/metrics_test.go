@@ -0,0 +1,42 @@
+package stats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricString(t *testing.T) {
+	assert.Equal(t, "cpu_percent", Metric{Name: "cpu_percent"}.String())
+	assert.Equal(t, `disk_used_percent{device="/dev/sda1",mount="/"}`, Metric{
+		Name:   "disk_used_percent",
+		Labels: map[string]string{"mount": "/", "device": "/dev/sda1"},
+	}.String())
+
+	// A value that looks like more labels is not the same series as those
+	// labels.
+	one := Metric{Name: "m", Labels: map[string]string{"a": `x",b="y`}}
+	two := Metric{Name: "m", Labels: map[string]string{"a": "x", "b": "y"}}
+	assert.NotEqual(t, one.String(), two.String())
+	one = Metric{Name: "m", Labels: map[string]string{"a": "x,b=y"}}
+	assert.NotEqual(t, one.String(), two.String())
+}
+
+func TestMetricsFilesModified(t *testing.T) {
+	docs, desk, total := 150, 80, 230
+	s := &Sample{
+		Watches: []WatchStats{
+			{Name: "docs", FilesModified: &docs},
+			{Name: "desk", FilesModified: &desk},
+		},
+		FilesModified: &total,
+	}
+	assert.ElementsMatch(t, []Metric{
+		{Name: "files_modified", Labels: map[string]string{"watch": "docs"}, Value: 150},
+		{Name: "files_modified", Labels: map[string]string{"watch": "desk"}, Value: 80},
+		{Name: "files_modified_total", Value: 230},
+	}, s.Metrics())
+
+	// On a baseline scan nothing is counted.
+	assert.Empty(t, (&Sample{Watches: []WatchStats{{Name: "docs"}}}).Metrics())
+}
@@ -0,0 +1,164 @@
+package stats
+
+import (
+	"daemon/internal/file"
+	"daemon/internal/monitor"
+	_ "embed"
+	"time"
+)
+
+// SchemaVersion is bumped whenever a field is removed or changes meaning.
+// Adding fields does not bump it. The matching JSON Schema is Schema.
+const SchemaVersion = 2
+
+//go:embed schema.json
+var Schema []byte
+
+// Sample is everything collected in one tick. It is what gets written to the
+// stats log and uploaded to the API endpoint. Sections that could not be
+// collected, or whose collector was not due this tick, are null.
+type Sample struct {
+	SchemaVersion int       `json:"schema_version"`
+	Timestamp     time.Time `json:"timestamp"`
+	// Host identifies the machine the sample was taken on.
+	Host *Host `json:"host"`
+	// FilesModified counts the files created or modified since the previous
+	// scan, summed over the watch entries scanned this tick. It is null when
+	// none of them had been scanned before.
+	FilesModified *int `json:"files_modified"`
+	// Watches holds the file changes of the watch entries scanned this
+	// tick.
+	Watches []WatchStats `json:"watches,omitempty"`
+	// Integrity holds the integrity checks of the watch entries checked
+	// this tick, on the schedule of their entry by default.
+	Integrity []IntegrityStats      `json:"integrity,omitempty"`
+	System    *monitor.SystemStats  `json:"system"`
+	Network   *monitor.NetworkStats `json:"network"`
+	Processes *monitor.ProcessStats `json:"processes"`
+	Sockets   *monitor.SocketStats  `json:"sockets"`
+	// Inventory is only set on the ticks the inventory collector ran, at
+	// startup and then daily by default.
+	Inventory *monitor.HostInventory `json:"inventory,omitempty"`
+	// Software is only set on the ticks the software collector ran, hourly
+	// by default.
+	Software *monitor.SoftwareStats `json:"software,omitempty"`
+	// Queries holds the results of the scheduled query packs that ran this
+	// tick.
+	Queries []QueryResult `json:"queries,omitempty"`
+	// Compliance is only set on the ticks the compliance checks ran, hourly
+	// by default.
+	Compliance *ComplianceReport `json:"compliance,omitempty"`
+	// Alerts lists the alert rules that started firing or resolved this
+	// tick.
+	Alerts []Alert `json:"alerts,omitempty"`
+	// Anomalies lists the metrics that deviated from their baseline this
+	// tick.
+	Anomalies []Anomaly `json:"anomalies,omitempty"`
+	// Errors maps the name of each collector that failed this tick to its
+	// error. Its section of the sample is null.
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+func NewSample(now time.Time) *Sample {
+	return &Sample{
+		SchemaVersion: SchemaVersion,
+		Timestamp:     now.UTC().Truncate(time.Second),
+	}
+}
+
+// Host is the host context attached to every sample. UUID is empty until the
+// inventory has been collected.
+type Host struct {
+	Hostname string `json:"hostname"`
+	UUID     string `json:"uuid"`
+}
+
+// QueryResult is one run of a scheduled pack query. Snapshot queries fill
+// Rows; differential queries fill Added and Removed with the changes since
+// their previous run.
+type QueryResult struct {
+	Pack    string              `json:"pack"`
+	Query   string              `json:"query"`
+	Mode    string              `json:"mode"`
+	Counter int                 `json:"counter"`
+	Rows    []map[string]string `json:"rows,omitempty"`
+	Added   []map[string]string `json:"added,omitempty"`
+	Removed []map[string]string `json:"removed,omitempty"`
+}
+
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// Alert is a state change of an alert rule for one metric series.
+type Alert struct {
+	Rule       string            `json:"rule"`
+	Severity   string            `json:"severity"`
+	State      string            `json:"state"`
+	Metric     string            `json:"metric"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Value      float64           `json:"value"`
+	Operator   string            `json:"operator"`
+	Threshold  float64           `json:"threshold"`
+	Message    string            `json:"message"`
+	FiredAt    time.Time         `json:"fired_at"`
+	ResolvedAt *time.Time        `json:"resolved_at"`
+}
+
+// WatchStats is the scan of one watch entry.
+type WatchStats struct {
+	Name      string            `json:"name"`
+	Path      string            `json:"path"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	FileCount int               `json:"file_count"`
+	// FilesModified is null on the first scan of the entry.
+	FilesModified *int `json:"files_modified"`
+	// Events lists what changed since the previous scan, and is empty on
+	// the first.
+	Events []file.Event `json:"events"`
+}
+
+// IntegrityStats is the integrity check of one watch entry.
+type IntegrityStats struct {
+	Name   string            `json:"name"`
+	Path   string            `json:"path"`
+	Labels map[string]string `json:"labels,omitempty"`
+	file.IntegrityReport
+}
+
+const (
+	CheckPass  = "pass"
+	CheckFail  = "fail"
+	CheckError = "error"
+)
+
+// ComplianceReport is the outcome of one run of the compliance checks.
+type ComplianceReport struct {
+	Time    time.Time     `json:"time"`
+	Passed  int           `json:"passed"`
+	Failed  int           `json:"failed"`
+	Errors  int           `json:"errors"`
+	Results []CheckResult `json:"results"`
+}
+
+type CheckResult struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Severity string `json:"severity,omitempty"`
+	Status   string `json:"status"`
+	// Message explains a failure or an error.
+	Message string `json:"message,omitempty"`
+}
+
+// Anomaly is a metric value that is further from its learned baseline than
+// the configured number of standard deviations.
+type Anomaly struct {
+	Metric   string            `json:"metric"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Value    float64           `json:"value"`
+	Expected float64           `json:"expected"`
+	StdDev   float64           `json:"std_dev"`
+	Score    float64           `json:"score"`
+	Hour     *int              `json:"hour,omitempty"`
+}
@@ -0,0 +1,37 @@
+package stats
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaMatchesSample(t *testing.T) {
+	var schema struct {
+		Required   []string `json:"required"`
+		Properties map[string]struct {
+			Const *int `json:"const"`
+		} `json:"properties"`
+	}
+	require.NoError(t, json.Unmarshal(Schema, &schema))
+
+	version := schema.Properties["schema_version"].Const
+	require.NotNil(t, version)
+	assert.Equal(t, SchemaVersion, *version)
+
+	data, err := json.Marshal(NewSample(time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)))
+	require.NoError(t, err)
+
+	var sample map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(data, &sample))
+	for _, field := range schema.Required {
+		assert.Contains(t, sample, field)
+	}
+	for field := range sample {
+		assert.Contains(t, schema.Properties, field, "field missing from schema.json")
+	}
+	assert.JSONEq(t, `"2024-10-01T12:00:00Z"`, string(sample["timestamp"]))
+}